@@ -1,49 +1,262 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/tommyshem/ogi/cmd/gitremote"
 	"gopkg.in/yaml.v2"
 )
 
+// localConfigFile is the per-directory config used before the central
+// registry existed. It still overrides the current repo when present.
+const localConfigFile = "./.ogi.yml"
+
+// repoFlag holds the --repo owner/repo persistent flag.
+var repoFlag string
+
+// Config is the configuration of one tracked repo. It is stored as an entry
+// of the central registry, and in the local .ogi.yml when one is used.
 type Config struct {
-	Owner       string    `yaml:"owner"`
-	Repo        string    `yaml:"repo"`
-	LastUpdated time.Time `yaml:"last_updated"`
+	Owner       string            `yaml:"owner"`
+	Repo        string            `yaml:"repo"`
+	LastUpdated time.Time         `yaml:"last_updated"`
+	State       string            `yaml:"state,omitempty"`
+	Options     map[string]string `yaml:"options,omitempty"`
+
+	// local is set when the config was loaded from a local .ogi.yml, which
+	// is then kept up to date by Save.
+	local bool
+}
+
+// GlobalConfig is the central registry of every repo tracked by ogi. It is
+// stored as ogi/config.yml in the user's XDG config directory.
+type GlobalConfig struct {
+	Current string        `yaml:"current,omitempty"`
+	Storage StorageConfig `yaml:"storage,omitempty"`
+	Repos   []*Config     `yaml:"repos"`
+	Views   []*View       `yaml:"views,omitempty"`
+}
+
+// View is a saved search, run with "ogi view run". It searches the current
+// repo unless it names the repos to search or is for all of them.
+type View struct {
+	Name     string   `yaml:"name"`
+	Query    string   `yaml:"query"`
+	Repos    []string `yaml:"repos,omitempty"`
+	AllRepos bool     `yaml:"all_repos,omitempty"`
+}
+
+// StorageConfig selects the storage backend holding the offline database.
+type StorageConfig struct {
+	Backend string `yaml:"backend,omitempty"`
+}
+
+// Name returns the repo in the "owner/repo" format.
+func (c *Config) Name() string {
+	return fmt.Sprintf("%s/%s", c.Owner, c.Repo)
+}
+
+// Option reports whether the boolean per-repo option is set.
+func (c *Config) Option(name string) bool {
+	return c.Options[name] == "true"
+}
+
+// SetOption sets a boolean per-repo option.
+func (c *Config) SetOption(name string, value bool) {
+	if c.Options == nil {
+		c.Options = map[string]string{}
+	}
+	c.Options[name] = strconv.FormatBool(value)
 }
 
-// TODO make multi repos to call offline to save going into repo folders
-// Save writes the configuration to the .ogi.yml file in the current working
-// directory. This should be called after setting the owner and repo fields.
+// Save writes the configuration to the central registry, and to the local
+// .ogi.yml file when the configuration was loaded from one. LastUpdated is
+// left as set by the caller, so it can record when a sync started rather
+// than when it finished.
 func (c *Config) Save() {
-	c.LastUpdated = time.Now()
-	data, _ := yaml.Marshal(c)
-	os.WriteFile("./.ogi.yml", data, 0755)
+	c.saveTo(LoadGlobalConfig())
+}
+
+// saveTo puts the configuration into the given registry before saving both.
+func (c *Config) saveTo(global *GlobalConfig) {
+	global.Put(c)
+	if err := global.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save %s: %s\n", GlobalConfigLocation(), err)
+	}
+	if c.local {
+		data, _ := yaml.Marshal(c)
+		os.WriteFile(localConfigFile, data, 0755)
+	}
 }
 
 // SetFromArgs takes the first argument passed in and assumes it's a
-// repository path in the format of "owner/repo". It splits the path
-// and sets the owner and repo fields, then saves the configuration.
+// repository path in the format of "owner/repo". It switches the config to
+// that repo, keeping what the registry already knows about it, makes it the
+// current repo and saves the configuration.
 func (config *Config) SetFromArgs(args []string) {
-	stringSplit := strings.Split(args[0], "/")
-	if len(stringSplit) == 2 {
-		config.Owner = stringSplit[0]
-		config.Repo = stringSplit[1]
-		config.Save()
+	owner, repo, ok := splitRepo(args[0])
+	if !ok {
+		return
+	}
+	global := LoadGlobalConfig()
+	if c := global.Find(owner, repo); c != nil {
+		c.local = config.local
+		*config = *c
+	} else if config.Owner != owner || config.Repo != repo {
+		*config = Config{Owner: owner, Repo: repo, local: config.local}
 	}
+	global.Current = config.Name()
+	config.saveTo(global)
 }
 
-// LoadConfig loads the configuration from the .ogi.yml file in the current
-// directory. If the file doesn't exist, or there's an error loading it, it
-// returns a new Config object.
+// LoadConfig loads the configuration of the current repo. The repo given with
+// the --repo flag wins, then the .ogi.yml file in the current directory, then
+// the GitHub remote of the git repo the current directory is in, then the
+// current repo of the central registry. If none is set, or there's an
+// error loading them, it returns a new Config object.
 func LoadConfig() *Config {
+	global := LoadGlobalConfig()
+	if repoFlag != "" {
+		owner, repo, ok := splitRepo(repoFlag)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "--repo %q is not in the owner/repo format\n", repoFlag)
+			os.Exit(-1)
+		}
+		if c := global.Find(owner, repo); c != nil {
+			return c
+		}
+		return &Config{Owner: owner, Repo: repo}
+	}
+
 	config := &Config{}
-	data, err := os.ReadFile("./.ogi.yml")
-	if err != nil {
+	data, err := os.ReadFile(localConfigFile)
+	if err == nil {
+		yaml.Unmarshal(data, config)
+		config.local = true
 		return config
 	}
-	yaml.Unmarshal(data, config)
+
+	if owner, repo, err := gitremote.Find("."); err == nil {
+		if c := global.Find(owner, repo); c != nil {
+			return c
+		}
+		return &Config{Owner: owner, Repo: repo}
+	}
+
+	if global.Current != "" {
+		if owner, repo, ok := splitRepo(global.Current); ok {
+			if c := global.Find(owner, repo); c != nil {
+				return c
+			}
+		}
+	}
 	return config
 }
+
+// GlobalConfigLocation returns the path to the central registry file,
+// $XDG_CONFIG_HOME/ogi/config.yml (~/.config/ogi/config.yml by default).
+func GlobalConfigLocation() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ogi", "config.yml")
+}
+
+// LoadGlobalConfig loads the central registry. If the file doesn't exist, or
+// there's an error loading it, it returns an empty registry.
+func LoadGlobalConfig() *GlobalConfig {
+	global := &GlobalConfig{}
+	data, err := os.ReadFile(GlobalConfigLocation())
+	if err != nil {
+		return global
+	}
+	yaml.Unmarshal(data, global)
+	return global
+}
+
+// Save writes the central registry, creating its directory when needed.
+func (g *GlobalConfig) Save() error {
+	location := GlobalConfigLocation()
+	if location == "" {
+		return fmt.Errorf("no config directory found")
+	}
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(location, data, 0644)
+}
+
+// Find returns the registry entry for the owner and repo, or nil when the
+// repo isn't tracked.
+func (g *GlobalConfig) Find(owner string, repo string) *Config {
+	for _, c := range g.Repos {
+		if strings.EqualFold(c.Owner, owner) && strings.EqualFold(c.Repo, repo) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Put adds the config to the registry, replacing the entry of the same repo.
+func (g *GlobalConfig) Put(config *Config) {
+	c := *config
+	c.local = false
+	for i, existing := range g.Repos {
+		if strings.EqualFold(existing.Owner, c.Owner) && strings.EqualFold(existing.Repo, c.Repo) {
+			g.Repos[i] = &c
+			return
+		}
+	}
+	g.Repos = append(g.Repos, &c)
+}
+
+// FindView returns the view with the name, or nil when there is none.
+func (g *GlobalConfig) FindView(name string) *View {
+	for _, v := range g.Views {
+		if strings.EqualFold(v.Name, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// PutView adds the view to the registry, replacing the view of the same name.
+func (g *GlobalConfig) PutView(view *View) {
+	for i, existing := range g.Views {
+		if strings.EqualFold(existing.Name, view.Name) {
+			g.Views[i] = view
+			return
+		}
+	}
+	g.Views = append(g.Views, view)
+}
+
+// DeleteView removes the view with the name, reporting whether there was one.
+func (g *GlobalConfig) DeleteView(name string) bool {
+	for i, v := range g.Views {
+		if strings.EqualFold(v.Name, name) {
+			g.Views = append(g.Views[:i], g.Views[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// splitRepo splits a repository path in the "owner/repo" format.
+func splitRepo(path string) (string, string, bool) {
+	stringSplit := strings.Split(path, "/")
+	if len(stringSplit) != 2 || stringSplit[0] == "" || stringSplit[1] == "" {
+		return "", "", false
+	}
+	return stringSplit[0], stringSplit[1], true
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configDirs points the central config at a new directory and changes to a
+// new working directory for the test, returning the latter.
+func configDirs(t *testing.T) string {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// writeFile writes a file of the test, creating its directory.
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLocal returns the local .ogi.yml of the directory, nil when there is
+// none.
+func readLocal(t *testing.T, dir string) *Config {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, ".ogi.yml"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer func() { repoFlag = "" }()
+	registry := &GlobalConfig{
+		Current: "octo/current",
+		Repos: []*Config{
+			{Owner: "octo", Repo: "hello", State: "open"},
+			{Owner: "my-org", Repo: "hello-world", State: "closed"},
+			{Owner: "octo", Repo: "current", State: "all"},
+		},
+	}
+	tests := []struct {
+		name    string
+		global  *GlobalConfig
+		flag    string
+		local   string
+		remote  string
+		want    string
+		state   string
+		isLocal bool
+	}{
+		{"--repo wins", registry, "My-Org/Hello-World", "owner: local\nrepo: override\n", "octo/hello", "my-org/hello-world", "closed", false},
+		{"--repo of an untracked repo", registry, "new/repo", "owner: local\nrepo: override\n", "octo/hello", "new/repo", "", false},
+		{".ogi.yml before the git remote", registry, "", "owner: local\nrepo: override\nstate: open\n", "octo/hello", "local/override", "open", true},
+		{"the git remote before the current repo", registry, "", "", "octo/hello", "octo/hello", "open", false},
+		{"the git remote of an untracked repo", registry, "", "", "someone/else", "someone/else", "", false},
+		{"the current repo", registry, "", "", "", "octo/current", "all", false},
+		{"a current repo that isn't tracked", &GlobalConfig{Current: "octo/gone"}, "", "", "", "/", "", false},
+		{"nothing set", &GlobalConfig{}, "", "", "", "/", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := configDirs(t)
+			if err := tt.global.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.local != "" {
+				writeFile(t, filepath.Join(dir, ".ogi.yml"), tt.local)
+			}
+			if tt.remote != "" {
+				writeFile(t, filepath.Join(dir, ".git", "config"), "[remote \"origin\"]\n\turl = git@github.com:"+tt.remote+".git\n")
+			}
+			repoFlag = tt.flag
+
+			c := LoadConfig()
+			if c.Name() != tt.want || c.State != tt.state || c.local != tt.isLocal {
+				t.Errorf("LoadConfig = %s state %q local %t, want %s state %q local %t", c.Name(), c.State, c.local, tt.want, tt.state, tt.isLocal)
+			}
+		})
+	}
+}
+
+// TestSetFromArgs checks switching repos keeps what the registry knows about
+// the repo, makes it the current one, and keeps a local .ogi.yml up to date.
+func TestSetFromArgs(t *testing.T) {
+	dir := configDirs(t)
+	global := &GlobalConfig{Repos: []*Config{{Owner: "my-org", Repo: "hello-world", State: "closed"}}}
+	if err := global.Save(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".ogi.yml"), "owner: octo\nrepo: hello\n")
+
+	c := LoadConfig()
+	c.SetFromArgs([]string{"my-org/hello-world"})
+	if c.Name() != "my-org/hello-world" || c.State != "closed" || !c.local {
+		t.Errorf("SetFromArgs switched to %s state %q local %t, want the tracked my-org/hello-world, still local", c.Name(), c.State, c.local)
+	}
+	if local := readLocal(t, dir); local == nil || local.Name() != "my-org/hello-world" || local.State != "closed" {
+		t.Errorf("the local .ogi.yml holds %+v, want my-org/hello-world", local)
+	}
+	global = LoadGlobalConfig()
+	if global.Current != "my-org/hello-world" || len(global.Repos) != 1 {
+		t.Errorf("the registry has current %q and repos %+v, want my-org/hello-world once", global.Current, global.Repos)
+	}
+	if got := LoadConfig(); got.Name() != "my-org/hello-world" || !got.local {
+		t.Errorf("LoadConfig after the switch = %s local %t, want the local my-org/hello-world", got.Name(), got.local)
+	}
+
+	// an untracked repo is added to the registry, the local file follows
+	c.SetFromArgs([]string{"octo/new"})
+	if c.Name() != "octo/new" || c.State != "" || !c.local {
+		t.Errorf("SetFromArgs switched to %s state %q local %t, want a new octo/new, still local", c.Name(), c.State, c.local)
+	}
+	if local := readLocal(t, dir); local == nil || local.Name() != "octo/new" {
+		t.Errorf("the local .ogi.yml holds %+v, want octo/new", local)
+	}
+	global = LoadGlobalConfig()
+	if global.Current != "octo/new" || len(global.Repos) != 2 || global.Find("octo", "new") == nil {
+		t.Errorf("the registry has current %q and repos %+v, want octo/new added", global.Current, global.Repos)
+	}
+
+	// not in the owner/repo format, nothing changes
+	c.SetFromArgs([]string{"octo"})
+	if c.Name() != "octo/new" || LoadGlobalConfig().Current != "octo/new" {
+		t.Errorf("SetFromArgs(octo) switched to %s", c.Name())
+	}
+
+	// without a local .ogi.yml only the registry is written
+	other := configDirs(t)
+	c = LoadConfig()
+	c.SetFromArgs([]string{"octo/hello"})
+	if local := readLocal(t, other); local != nil {
+		t.Errorf("SetFromArgs wrote a local .ogi.yml holding %+v", local)
+	}
+	if got := LoadConfig(); got.Name() != "octo/hello" || got.local {
+		t.Errorf("LoadConfig after the switch = %s local %t, want the current octo/hello", got.Name(), got.local)
+	}
+}
+
+func TestPut(t *testing.T) {
+	g := &GlobalConfig{}
+	hello := &Config{Owner: "octo", Repo: "hello", State: "open", local: true}
+	g.Put(hello)
+	g.Put(&Config{Owner: "my-org", Repo: "hello-world"})
+	g.Put(&Config{Owner: "Octo", Repo: "Hello", State: "closed"})
+	if len(g.Repos) != 2 || g.Repos[0].Name() != "Octo/Hello" || g.Repos[0].State != "closed" || g.Repos[1].Name() != "my-org/hello-world" {
+		t.Errorf("Put replaced octo/hello as %+v, want it replaced in place", g.Repos)
+	}
+
+	// the registry holds a copy, without the local flag
+	g = &GlobalConfig{}
+	g.Put(hello)
+	hello.State = "all"
+	if c := g.Find("octo", "hello"); c == nil || c.State != "open" || c.local {
+		t.Errorf("Put stored %+v, want a copy of octo/hello that isn't local", c)
+	}
+}
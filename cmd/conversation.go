@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/markdown"
+)
+
+// quoteLine matches the lines of a Markdown block quote.
+var quoteLine = regexp.MustCompile(`^ {0,3}>`)
+
+// quoted is the text of a body said earlier in a conversation, to find who
+// a reply quotes.
+type quoted struct {
+	login string
+	text  string
+}
+
+// showConversation prints the comments, reviews and timeline events of an
+// issue in the order they happened. Entries before since are left out,
+// quotes of earlier bodies are collapsed to a line naming their author.
+func showConversation(is issue.Issue, since time.Time) {
+	entries := is.Conversation()
+	maintainers := is.Maintainers()
+	said := []quoted{{is.User.Login, flatten(unquoted(is.Body))}}
+
+	hidden := 0
+	for _, e := range entries {
+		if e.Time.Before(since) {
+			hidden++
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Println("\n=== Conversation ===")
+	if hidden > 0 {
+		fmt.Printf("\n%d earlier comments and events before %s are hidden.\n", hidden, since.In(time.Local).Format("2006-01-02 15:04"))
+	}
+	inEvents := false
+	for _, e := range entries {
+		var login, action, body string
+		var reactions *issue.Reactions
+		switch {
+		case e.Event != nil:
+			if e.Time.Before(since) {
+				continue
+			}
+			// events are listed one after the other, between the comments
+			if !inEvents {
+				fmt.Println()
+			}
+			inEvents = true
+			line := fmt.Sprintf("  • %s %s · %s", e.Event.Actor.Login, e.Event.Describe(), e.Time.In(time.Local).Format("2006-01-02 15:04"))
+			fmt.Println(styled(markdown.Faint, line))
+			continue
+		case e.Comment != nil:
+			login, action, body, reactions = e.Comment.User.Login, "commented", e.Comment.Body, e.Comment.Reactions
+		case e.Review != nil:
+			login, action, body = e.Review.User.Login, reviewAction(e.Review.State), e.Review.Body
+		}
+		collapsed := collapseQuotes(body, said)
+		said = append(said, quoted{login, flatten(unquoted(body))})
+		if e.Time.Before(since) {
+			continue
+		}
+		inEvents = false
+
+		author := styled(markdown.Bold, login)
+		if login == is.User.Login {
+			author += styled(markdown.Faint, " (author)")
+		}
+		if maintainers[login] {
+			author += styled(markdown.Faint, " (maintainer)")
+		}
+		fmt.Printf("\n── %s %s · %s\n", author, action, e.Time.In(time.Local).Format("2006-01-02 15:04"))
+		if strings.TrimSpace(collapsed) != "" {
+			printMarkdown(collapsed)
+		}
+		if reactions != nil && reactions.Total > 0 {
+			fmt.Println(reactions.FmtReactions())
+		}
+	}
+}
+
+// reviewAction describes a pull request review by its state.
+func reviewAction(state string) string {
+	switch state {
+	case "APPROVED":
+		return "approved these changes"
+	case "CHANGES_REQUESTED":
+		return "requested changes"
+	case "DISMISSED":
+		return "reviewed (dismissed)"
+	}
+	return "reviewed"
+}
+
+// collapseQuotes replaces the block quotes of a body that quote an earlier
+// body of the conversation with a line naming who wrote it, the last one
+// saying it when several did.
+func collapseQuotes(body string, said []quoted) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	out := []string{}
+	for i := 0; i < len(lines); {
+		if !quoteLine.MatchString(lines[i]) {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && quoteLine.MatchString(lines[end]) {
+			end++
+		}
+		text := flatten(strings.Join(lines[i:end], "\n"))
+		who := ""
+		for _, q := range said {
+			if text != "" && strings.Contains(q.text, text) {
+				who = q.login
+			}
+		}
+		if who == "" {
+			out = append(out, lines[i:end]...)
+		} else {
+			out = append(out, fmt.Sprintf("> *%s wrote:* %s", who, abbreviate(text, 60)))
+		}
+		i = end
+	}
+	return strings.Join(out, "\n")
+}
+
+// unquoted returns the lines of Markdown text that aren't block quotes.
+func unquoted(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if !quoteLine.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flatten returns the words of Markdown text without its quote markers, to
+// compare quotes with what was quoted.
+func flatten(text string) string {
+	words := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		words = append(words, strings.Fields(strings.TrimLeft(line, " >"))...)
+	}
+	return strings.Join(words, " ")
+}
+
+// abbreviate cuts text to at most n characters, ending it with an ellipsis.
+func abbreviate(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n-1]) + "…"
+}
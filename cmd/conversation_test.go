@@ -0,0 +1,65 @@
+package cmd
+
+import "testing"
+
+func TestCollapseQuotes(t *testing.T) {
+	said := []quoted{
+		{"alice", "The app crashes on start since the last update, every time I open it."},
+		{"bob", "Which version are you on?"},
+		{"carol", "Same here on v1.2"},
+		{"dave", "Same here"},
+	}
+	for n := range said {
+		said[n].text = flatten(said[n].text)
+	}
+	tests := []struct {
+		name, body, want string
+	}{
+		{"no quote", "Thanks!", "Thanks!"},
+		{"whole body",
+			"> Which version are you on?\n\nv1.2",
+			"> *bob wrote:* Which version are you on?\n\nv1.2"},
+		{"part of a body",
+			"> since the last update\n\nwhich one?",
+			"> *alice wrote:* since the last update\n\nwhich one?"},
+		{"a quote over lines, wrapped anew",
+			">The app crashes on start\n>   since the last\n  > update\nok",
+			"> *alice wrote:* The app crashes on start since the last update\nok"},
+		{"the last who said it",
+			"> Same here\n+1",
+			"> *dave wrote:* Same here\n+1"},
+		{"long quotes are cut",
+			"> The app crashes on start since the last update, every time I open it.",
+			"> *alice wrote:* The app crashes on start since the last update, every time …"},
+		{"two quotes",
+			"> Which version\nv1.3\n> on v1.2\nmine too",
+			"> *bob wrote:* Which version\nv1.3\n> *carol wrote:* on v1.2\nmine too"},
+		{"nested quote",
+			"> > Which version are you on?",
+			"> *bob wrote:* Which version are you on?"},
+		// the lines of a block mixing a quote of a quote with the reply it
+		// had weren't said by anyone alone, so they're kept
+		{"nested quote and its reply",
+			"> > Which version are you on?\n> v1.2\n\nme too",
+			"> > Which version are you on?\n> v1.2\n\nme too"},
+		{"not said", "> Have you tried turning it off?\nno", "> Have you tried turning it off?\nno"},
+		{"not all of it said", "> Which version are you on? And which OS?", "> Which version are you on? And which OS?"},
+		{"empty quote", ">\n>\nhi", ">\n>\nhi"},
+		{"code isn't a quote", "    > Which version are you on?", "    > Which version are you on?"},
+		{"windows line ends",
+			"> Which version are you on?\r\nv1.2",
+			"> *bob wrote:* Which version are you on?\nv1.2"},
+	}
+	for _, tt := range tests {
+		if got := collapseQuotes(tt.body, said); got != tt.want {
+			t.Errorf("%s: collapseQuotes(%q) = %q, want %q", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestUnquoted(t *testing.T) {
+	body := "> Which version are you on?\n>> nested\nv1.2\n   > indented\n    > code\nbye"
+	if got, want := unquoted(body), "v1.2\n    > code\nbye"; got != want {
+		t.Errorf("unquoted(%q) = %q, want %q", body, got, want)
+	}
+}
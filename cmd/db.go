@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/conformance"
+)
+
+// dbCmd groups the commands working on the offline database itself.
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the offline issues database.",
+}
+
+// dbCheckCmd runs the storage conformance checks.
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the storage backends behave the same, using a throwaway database.",
+	Long: `Check runs the same checks against every storage backend, or only the one
+picked with --backend, each in a temporary database. Your offline issues are
+not touched.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		names := storage.Backends()
+		if backendFlag != "" {
+			names = []string{backendFlag}
+		}
+		failed := false
+		for _, name := range names {
+			failures, err := checkBackend(name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(-1)
+			}
+			if len(failures) == 0 {
+				fmt.Printf("%s: ok\n", name)
+				continue
+			}
+			failed = true
+			fmt.Printf("%s: %d checks failed\n", name, len(failures))
+			for _, f := range failures {
+				fmt.Printf("\t%s\n", f)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// dbInfoCmd shows the layout of the offline database.
+var dbInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the location and schema version of the offline database.",
+	Run: func(cmd *cobra.Command, args []string) {
+		name := backendName()
+		backend, err := storage.Lookup(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		s, err := backend.Open()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		defer s.Close()
+		meta, err := s.Meta()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		repos, err := s.Repos()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Backend:        %s\n", name)
+		fmt.Printf("Location:       %s\n", backend.Location())
+		fmt.Printf("Schema version: %d (this ogi understands up to %d)\n", meta.SchemaVersion, storage.SchemaVersion)
+		fmt.Printf("Written by:     ogi %s\n", meta.OgiVersion)
+		fmt.Printf("Repos:          %d\n", len(repos))
+	},
+}
+
+// migrate flags
+var migrateFrom string
+var migrateTo string
+
+// dbMigrateCmd copies the offline issues from one backend to another.
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate --to <backend>",
+	Short: "Copy the offline issues of every repo to another storage backend and switch to it.",
+	Long: `Migrate copies every repo, issue and comment from one storage backend to
+another. Each repo is checked against the source, by issue count and checksum,
+before it is committed. Once every repo is copied the storage.backend key of the
+central config is switched to the new backend. The source database is kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if migrateFrom == "" {
+			migrateFrom = backendName()
+		}
+		if migrateTo == "" || migrateTo == migrateFrom {
+			fmt.Println("Pick the backend to migrate to with --to, other than the one migrated from.")
+			os.Exit(-1)
+		}
+		from, err := storage.Lookup(migrateFrom)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		if _, err := os.Stat(from.Location()); err != nil {
+			fmt.Printf("There is no %s database at %s to migrate.\n", migrateFrom, from.Location())
+			os.Exit(-1)
+		}
+		src, err := from.Open()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		defer src.Close()
+		dst, err := storage.Open(migrateTo)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		defer dst.Close()
+
+		repos := 0
+		err = storage.Migrate(src, dst, func(r storage.Repo, count int) {
+			repos++
+			fmt.Printf("%s/%s: %d issues copied\n", r.Owner, r.Repo, count)
+		})
+		if err != nil {
+			fmt.Println(err)
+			fmt.Printf("The migration was stopped, ogi still uses the %s backend.\n", migrateFrom)
+			os.Exit(-1)
+		}
+
+		global := LoadGlobalConfig()
+		global.Storage.Backend = migrateTo
+		if err := global.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Migrated %d repos from %s to %s, ogi now uses the %s backend.\n", repos, migrateFrom, migrateTo, migrateTo)
+	},
+}
+
+// checkBackend runs the conformance checks against a new database of the
+// named backend in a temporary folder.
+func checkBackend(name string) ([]error, error) {
+	backend, err := storage.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "ogi-check-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, filepath.Base(backend.Location()))
+	return conformance.Check(func() (storage.Storage, error) {
+		return backend.OpenAt(location)
+	}), nil
+}
+
+// init registers the db command and its sub commands with the root command.
+func init() {
+	RootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+	dbCmd.AddCommand(dbInfoCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbMigrateCmd.Flags().StringVar(&migrateFrom, "from", "", "Backend to copy the issues from, the configured one by default")
+	dbMigrateCmd.Flags().StringVar(&migrateTo, "to", "", "Backend to copy the issues to")
+}
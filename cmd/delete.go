@@ -5,7 +5,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/tommyshem/ogi/cmd/storage/bolt"
+	"github.com/tommyshem/ogi/cmd/storage"
 )
 
 var delete bool
@@ -15,7 +15,11 @@ var deleteDB = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete the local ogi offline database file on your system.",
 	Run: func(cmd *cobra.Command, args []string) {
-		err := os.Remove(bolt.Location())
+		backend, err := storage.Lookup(backendName())
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = os.RemoveAll(backend.Location())
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -2,22 +2,26 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
 	"github.com/tommyshem/ogi/cmd/issue"
-	storage "github.com/tommyshem/ogi/cmd/storage/bolt"
+	"github.com/tommyshem/ogi/cmd/storage"
 	"golang.org/x/oauth2"
 )
 
 var fetchState string
+var fetchPulls bool
+var fetchResume bool
 
 // fetchCmd represents the fetch command
 var fetchCmd = &cobra.Command{
@@ -25,103 +29,386 @@ var fetchCmd = &cobra.Command{
 	Short: "Fetches all of the issues for the specified repo.",
 	Long: `Fetches all of the issues for the specified repo.
 Pull down everything from GitHub and store it locally for offline use.
-This will clear any existing issues stored locally.
+This will replace any existing issues stored locally once the fetch has
+completed. If it fails or is interrupted, the issues fetched before are
+kept as they were, and the progress is saved so "ogi fetch --resume" can
+continue from where it stopped.
 
 The first time you run this command you should run it like such:
 
 $ ghi fetch owner/repo
 
-Subsequent calls will not need the "owner/repo".
+Subsequent calls will not need the "owner/repo", the repo is remembered
+in the central config file and becomes the current repo. Use the --repo
+flag to pick another tracked repo, or a local .ogi.yml file to pin one
+to a folder.
+
+The comments of every issue are stored with their reactions, together with
+the events of its timeline, like labels, assignments and references.
+
+Pull requests are stored as plain issues. Use --pulls to also store their
+branches, merge status, reviews, review comments and diff for offline
+review. The choice is remembered for the repo and used by "ogi update".
 
 If you are going to be calling a private repo you will need to
 set the ENV var "GITHUB_TOKEN" with a GitHub Personal Access Token.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		// TODO change config to load from inside git repo or a multi repo config
-
-		if len(args) == 0 {
-			config = LoadConfig()
-			if config.Repo == "" {
-				fmt.Println(`
+		config = LoadConfig()
+		if len(args) > 0 {
+			config.SetFromArgs(args)
+		}
+		if config.Repo == "" {
+			fmt.Println(`
 It looks like you haven't initialized OGI yet!
 
 The first time you run OGI you should run "ogi fetch owner/repo"
 or inside a git repo folder
 
 This will fetch all of your issues for that repository. `)
-				os.Exit(-1)
-			} else {
-				config.SetFromArgs(args)
-			}
+			os.Exit(-1)
+		}
+		if !cmd.Flags().Changed("state") && config.State != "" {
+			fetchState = config.State
+		}
+		config.State = fetchState
+		if cmd.Flags().Changed("pulls") {
+			config.SetOption("pulls", fetchPulls)
 		}
-		s, err := storage.New(config.Owner, config.Repo)
+		fetchPulls = config.Option("pulls")
+
+		s, err := storage.New(backendName(), config.Owner, config.Repo)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(-1)
 		}
 		db = s
 
-		err = db.Clear()
-		if err != nil {
-			log.Fatal(err)
+		// the issues are fetched into a staging copy, which only replaces the
+		// stored issues once everything was downloaded.
+		var stage storage.Storage
+		checkpoint := &storage.Checkpoint{Page: 1, State: fetchState, Pulls: fetchPulls, Started: time.Now()}
+		if fetchResume {
+			stage, checkpoint, err = db.Resume()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(-1)
+			}
+			fmt.Printf("Resuming the fetch of %s from page %d\n", config.Name(), checkpoint.Page)
+			config.State = checkpoint.State
+			config.SetOption("pulls", checkpoint.Pulls)
+		} else {
+			stage, err = db.Stage()
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 
-		more := true
-		count := 0
-		opts := &github.IssueListByRepoOptions{State: fetchState}
+		// pages are walked oldest first, so issues created during the fetch
+		// don't shift the pages of a resumed fetch.
+		opts := &github.IssueListByRepoOptions{
+			State:       checkpoint.State,
+			Sort:        "created",
+			Direction:   "asc",
+			ListOptions: github.ListOptions{Page: checkpoint.Page, PerPage: 100},
+		}
 
 		spin := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
-		spin.Suffix = fmt.Sprintf(" Fetching %s Issues (This could take a while depending on the number of issues and comments you have!)", fetchState)
+		spin.Suffix = fmt.Sprintf(" Fetching %s Issues (This could take a while depending on the number of issues and comments you have!)", checkpoint.State)
 		spin.Start()
 
-		client := newClient()
-		for more {
-			issues, resp, err := client.Issues.ListByRepo(context.Background(), db.Owner, db.Repo, opts)
+		// an interrupt stops handing out new issues and lets the ones being
+		// saved finish, a second one kills the process.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		f := newFetcher(newClient(), concurrency)
+		f.onWait = spinnerWait(spin)
+		failed := []error{}
+		incomplete := false
+		for {
+			if err := stage.SaveCheckpoint(*checkpoint); err != nil {
+				spin.Stop()
+				fmt.Println(err)
+				abortFetch(stage)
+			}
+			issues, resp, err := f.listIssues(ctx, config.Owner, config.Repo, opts)
 			if err != nil {
-				fmt.Printf("\n%s", err.Error())
+				spin.Stop()
+				if ctx.Err() == nil {
+					fmt.Printf("\n%s", err.Error())
+				}
 				if resp != nil && resp.StatusCode == 401 {
 					fmt.Println(`Couldn't access this repo! Try setting a GitHub Personal Token.
 
 This token can be set as an environment variable "GITHUB_TOKEN".`)
 				}
-				os.Exit(2)
+				abortFetch(stage)
 			}
-			count += len(issues)
 
-			Wait(len(issues), func(i int) {
-				issue := &issue.Issue{Issue: *issues[i], Comments: []*github.IssueComment{}}
-				comments, _, err := client.Issues.ListComments(context.Background(), db.Owner, db.Repo, *issue.Number, &github.IssueListCommentsOptions{})
-				if err != nil {
-					log.Fatal(err)
+			pageFailed := f.Run(ctx, len(issues), func(i int) error {
+				if done, err := stage.Has(issues[i].GetNumber()); err != nil || done {
+					return err
 				}
-				issue.Comments = comments
-				db.Save(*issue)
+				return fetchIssue(ctx, f, stage, issues[i], checkpoint.Pulls)
 			})
+			failed = append(failed, pageFailed...)
+			if ctx.Err() != nil {
+				break
+			}
+			// the checkpoint stays on the first page with missing issues,
+			// so a resumed fetch retries them.
+			if len(pageFailed) > 0 {
+				incomplete = true
+			}
 			if resp.NextPage == 0 {
 				break
 			}
 			opts.Page = resp.NextPage
+			if !incomplete {
+				checkpoint.Page = opts.Page
+			}
 		}
+		spin.Stop()
 
+		if ctx.Err() != nil {
+			fmt.Println("\nInterrupted.")
+			abortFetch(stage)
+		}
+		if len(failed) > 0 {
+			printIssueErrors(failed)
+			abortFetch(stage)
+		}
+		if err := stage.Commit(); err != nil {
+			fmt.Println(err)
+			abortFetch(stage)
+		}
+		count, err := db.Count()
 		if err != nil {
 			log.Fatal(err)
 		}
+		config.LastUpdated = checkpoint.Started
 		config.Save()
-		spin.Stop()
-		fmt.Printf("\nFetched %d issues for %s/%s\n", count, db.Owner, db.Repo)
+		if err := db.SetLastUpdated(checkpoint.Started); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\nFetched %d issues for %s\n", count, config.Name())
 	},
 }
 
-func Wait(length int, block func(index int)) {
-	var w sync.WaitGroup
-	w.Add(length)
-	for i := 0; i < length; i++ {
-		go func(w *sync.WaitGroup, index int) {
-			block(index)
-			w.Done()
-		}(&w, i)
+// abortFetch keeps the staged issues of a failed fetch and its checkpoint
+// for "ogi fetch --resume", tells the user the previously stored issues were
+// kept and exits.
+func abortFetch(stage storage.Storage) {
+	r := stage.Repository()
+	fmt.Printf("\nThe fetch did not complete, the previous snapshot of %s/%s was preserved.\n", r.Owner, r.Repo)
+	fmt.Println("Run \"ogi fetch --resume\" to continue where it stopped, or \"ogi fetch\" to start over.")
+	os.Exit(2)
+}
+
+// fetchIssue downloads the comments and timeline for the given GitHub issue
+// and saves the issue together with them to the store. When pulls is set and
+// the issue is a pull request its review data is downloaded as well. Errors
+// are returned as an issueError naming the issue.
+func fetchIssue(ctx context.Context, f *fetcher, s storage.Storage, gi *github.Issue, pulls bool) error {
+	r := s.Repository()
+	is := issue.FromGitHub(gi)
+	comments, err := fetchComments(ctx, f, r.Owner, r.Repo, is.Number)
+	if isGone(err) {
+		// the issue was deleted or transferred, drop the stored copy.
+		if found, _ := s.Has(is.Number); found {
+			if err := s.Delete(is.Number); err != nil {
+				return issueError{Number: is.Number, Err: err}
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return issueError{Number: is.Number, Err: err}
+	}
+	is.Comments = issue.CommentsFromGitHub(comments)
+	events, err := fetchTimeline(ctx, f, r.Owner, r.Repo, is.Number)
+	if err != nil {
+		return issueError{Number: is.Number, Err: err}
+	}
+	is.Events = issue.EventsFromGitHub(events)
+	if pulls && is.IsPull {
+		is.PullRequest, err = fetchPullRequest(ctx, f, r.Owner, r.Repo, is.Number)
+		if err != nil {
+			return issueError{Number: is.Number, Err: err}
+		}
+	}
+	if err := s.Save(is); err != nil {
+		return issueError{Number: is.Number, Err: err}
+	}
+	return nil
+}
+
+// isGone reports whether err is GitHub answering 404 Not Found or 410 Gone,
+// which it does for issues that were deleted or transferred to another repo.
+func isGone(err error) bool {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	return errResp.Response.StatusCode == http.StatusNotFound || errResp.Response.StatusCode == http.StatusGone
+}
+
+// listIssues fetches one page of the repo's issues.
+func (f *fetcher) listIssues(ctx context.Context, owner string, repo string, opts *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+	var issues []*github.Issue
+	var resp *github.Response
+	err := f.do(ctx, func() (*github.Response, error) {
+		var err error
+		issues, resp, err = f.client.Issues.ListByRepo(ctx, owner, repo, opts)
+		return resp, err
+	})
+	return issues, resp, err
+}
+
+// fetchComments downloads every comment of an issue, following the pages
+// with the largest page size GitHub allows.
+func fetchComments(ctx context.Context, f *fetcher, owner string, repo string, number int) ([]*github.IssueComment, error) {
+	comments := []*github.IssueComment{}
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var page []*github.IssueComment
+		var resp *github.Response
+		err := f.do(ctx, func() (*github.Response, error) {
+			var err error
+			page, resp, err = f.client.Issues.ListComments(ctx, owner, repo, number, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return comments, nil
+}
+
+// fetchTimeline downloads every event of an issue's timeline. The request
+// is made by hand to decode the source of cross-references, see
+// issue.GitHubEvent.
+func fetchTimeline(ctx context.Context, f *fetcher, owner string, repo string, number int) ([]*issue.GitHubEvent, error) {
+	events := []*issue.GitHubEvent{}
+	page := 1
+	for {
+		req, err := f.client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/issues/%d/timeline?per_page=100&page=%d", owner, repo, number, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.mockingbird-preview+json")
+		var batch []*issue.GitHubEvent
+		var resp *github.Response
+		err = f.do(ctx, func() (*github.Response, error) {
+			var err error
+			batch = nil
+			resp, err = f.client.Do(ctx, req, &batch)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+	return events, nil
+}
+
+// fetchPullRequest downloads the branch and merge details, the reviews, the
+// line level review comments and the unified diff of a pull request.
+func fetchPullRequest(ctx context.Context, f *fetcher, owner string, repo string, number int) (*issue.PullRequest, error) {
+	var pr *github.PullRequest
+	err := f.do(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		pr, resp, err = f.client.PullRequests.Get(ctx, owner, repo, number)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := issue.NewPullRequest(pr)
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var reviews []*github.PullRequestReview
+		var resp *github.Response
+		err := f.do(ctx, func() (*github.Response, error) {
+			var err error
+			reviews, resp, err = f.client.PullRequests.ListReviews(ctx, owner, repo, number, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range reviews {
+			p.Reviews = append(p.Reviews, issue.ReviewFromGitHub(r))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	commentOpts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var comments []*github.PullRequestComment
+		var resp *github.Response
+		err := f.do(ctx, func() (*github.Response, error) {
+			var err error
+			comments, resp, err = f.client.PullRequests.ListComments(ctx, owner, repo, number, commentOpts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range comments {
+			p.ReviewComments = append(p.ReviewComments, issue.ReviewCommentFromGitHub(c))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.Page = resp.NextPage
+	}
+
+	err = f.do(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		p.Diff, resp, err = f.client.PullRequests.GetRaw(ctx, owner, repo, number, github.RawOptions{Type: github.Diff})
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// spinnerWait returns a fetcher onWait callback showing the pauses in the
+// spinner's suffix, restoring the original suffix once requests resume.
+func spinnerWait(spin *spinner.Spinner) func(until time.Time, reason string) {
+	suffix := spin.Suffix
+	return func(until time.Time, reason string) {
+		spin.Lock()
+		defer spin.Unlock()
+		if until.IsZero() {
+			spin.Suffix = suffix
+			return
+		}
+		spin.Suffix = fmt.Sprintf(" Paused until %s: %s", until.In(time.Local).Format(time.TimeOnly), reason)
 	}
-	w.Wait()
 }
 
 // newClient returns a new github.Client. If the GITHUB_TOKEN environment
@@ -144,4 +431,7 @@ func newClient() *github.Client {
 func init() {
 	RootCmd.AddCommand(fetchCmd)
 	fetchCmd.Flags().StringVarP(&fetchState, "state", "s", "all", "Fetch issues by their state <all, closed, open>")
+	fetchCmd.Flags().IntVarP(&concurrency, "concurrency", "j", 4, "Number of issues fetched at the same time")
+	fetchCmd.Flags().BoolVar(&fetchResume, "resume", false, "Continue an interrupted fetch from its checkpoint")
+	fetchCmd.Flags().BoolVarP(&fetchPulls, "pulls", "p", false, "Also fetch the reviews, review comments and diff of pull requests")
 }
@@ -0,0 +1,152 @@
+package fulltext
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// maxTokenLength is the length of the longest token indexed, longer ones are
+// hashes, urls and the like nobody searches for by hand.
+const maxTokenLength = 64
+
+// Doc is an issue broken into the terms of the full text index. The title,
+// the body and every comment are one after the other, with one position left
+// empty between them so a phrase never spans two of them.
+type Doc struct {
+	Number int
+	// Length is the number of tokens of the issue.
+	Length int
+	// TitleEnd is the position the body starts at, BodyEnd the one the
+	// comments start at.
+	TitleEnd int
+	BodyEnd  int
+	// Terms are the positions of every term in the issue.
+	Terms map[string][]int
+}
+
+// Field returns title, body or comments for a position of the doc.
+func (d Doc) Field(position int) string {
+	switch {
+	case position < d.TitleEnd:
+		return "title"
+	case position < d.BodyEnd:
+		return "body"
+	}
+	return "comments"
+}
+
+// Tokens splits text into lower cased words of letters and digits.
+func Tokens(text string) []string {
+	tokens := []string{}
+	for _, t := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(t) <= maxTokenLength {
+			tokens = append(tokens, strings.ToLower(t))
+		}
+	}
+	return tokens
+}
+
+// Terms returns the stemmed tokens of text, as they are indexed.
+func Terms(text string) []string {
+	terms := Tokens(text)
+	for n, t := range terms {
+		terms[n] = Stem(t)
+	}
+	return terms
+}
+
+// Analyze breaks the title, body and comments of an issue into terms.
+func Analyze(i issue.Issue) Doc {
+	d := Doc{Number: i.Number, Terms: map[string][]int{}}
+	position := 0
+	add := func(text string) {
+		for _, t := range Terms(text) {
+			d.Terms[t] = append(d.Terms[t], position)
+			position++
+			d.Length++
+		}
+		// leave a gap between fields
+		position++
+	}
+	add(i.Title)
+	d.TitleEnd = position
+	add(i.Body)
+	d.BodyEnd = position
+	for _, c := range i.Comments {
+		add(c.Body)
+	}
+	return d
+}
+
+// BM25 parameters, the usual defaults.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// BM25 returns the Okapi BM25 relevance of a term found frequency times in a
+// doc of the given length. docs is the number of docs indexed, withTerm the
+// number of them the term is found in and avgLength their average length.
+func BM25(frequency int, length int, docs int, withTerm int, avgLength float64) float64 {
+	idf := math.Log(1 + (float64(docs-withTerm)+0.5)/(float64(withTerm)+0.5))
+	tf := float64(frequency)
+	norm := 1.0
+	if avgLength > 0 {
+		norm = 1 - b + b*float64(length)/avgLength
+	}
+	return idf * tf * (k1 + 1) / (tf + k1*norm)
+}
+
+// maxSnippetLength is the length of the longest snippet, in runes.
+const maxSnippetLength = 100
+
+// Snippets returns up to limit lines of text holding one of the terms,
+// shortened around the first term found when they are too long.
+func Snippets(text string, terms map[string]bool, limit int) []string {
+	snippets := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if len(snippets) >= limit {
+			break
+		}
+		line = strings.TrimSpace(line)
+		first := -1
+		for n, t := range Terms(line) {
+			if terms[t] {
+				first = n
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		snippets = append(snippets, shorten(line, Tokens(line)[first]))
+	}
+	return snippets
+}
+
+// shorten cuts a line down to maxSnippetLength runes around the first
+// occurrence of token, marking the cuts with ...
+func shorten(line string, token string) string {
+	runes := []rune(line)
+	if len(runes) <= maxSnippetLength {
+		return line
+	}
+	lower := strings.ToLower(line)
+	at := len([]rune(lower[:max(strings.Index(lower, token), 0)]))
+	start := max(at-maxSnippetLength/3, 0)
+	end := min(start+maxSnippetLength, len(runes))
+	start = max(end-maxSnippetLength, 0)
+	s := string(runes[start:end])
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(runes) {
+		s += "..."
+	}
+	return s
+}
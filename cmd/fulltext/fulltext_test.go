@@ -0,0 +1,238 @@
+package fulltext
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"", "[]"},
+		{"Crash on start", "[crash on start]"},
+		{"panic: index out-of-range (again)!", "[panic index out of rang again]"},
+		{"issue #12 in v1.2", "[issu 12 in v1 2]"},
+		{"Übergröße naïve", "[übergröße naïve]"},
+		{"sha " + strings.Repeat("0123456789", 7) + " end", "[sha end]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(Terms(tt.text)); got != tt.want {
+			t.Errorf("Terms(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	d := Analyze(issue.Issue{
+		Number: 7,
+		Title:  "Crash on start",
+		Body:   "The app crashes",
+		Comments: []issue.Comment{
+			{Body: "it crashed again"},
+			{Body: "works for me"},
+		},
+	})
+	// title 0-2, gap, body 4-6, gap, comments 8-10, gap, 12-14
+	want := map[string][]int{
+		"crash": {0, 6, 9},
+		"on":    {1},
+		"start": {2},
+		"the":   {4},
+		"app":   {5},
+		"it":    {8},
+		"again": {10},
+		"work":  {12},
+		"for":   {13},
+		"me":    {14},
+	}
+	if !reflect.DeepEqual(d.Terms, want) {
+		t.Errorf("Analyze terms = %v, want %v", d.Terms, want)
+	}
+	if d.Number != 7 || d.Length != 12 || d.TitleEnd != 4 || d.BodyEnd != 8 {
+		t.Errorf("Analyze = number %d, length %d, title end %d, body end %d, want 7, 12, 4, 8", d.Number, d.Length, d.TitleEnd, d.BodyEnd)
+	}
+	for position, field := range map[int]string{0: "title", 2: "title", 4: "body", 6: "body", 8: "comments", 14: "comments"} {
+		if got := d.Field(position); got != field {
+			t.Errorf("Field(%d) = %s, want %s", position, got, field)
+		}
+	}
+}
+
+// index is a small in-memory full text index, looking up words and phrases
+// the way the search package does with the stores.
+type index struct {
+	docs []Doc
+}
+
+func newIndex(issues ...issue.Issue) *index {
+	x := &index{}
+	for _, i := range issues {
+		x.docs = append(x.docs, Analyze(i))
+	}
+	return x
+}
+
+// phrase returns the number of times the terms of text are found one after
+// the other in each doc.
+func (x *index) phrase(text string) map[int]int {
+	terms := Terms(text)
+	counts := map[int]int{}
+	for _, d := range x.docs {
+		for _, p := range d.Terms[terms[0]] {
+			found := true
+			for n, term := range terms[1:] {
+				at := sort.SearchInts(d.Terms[term], p+n+1)
+				if at == len(d.Terms[term]) || d.Terms[term][at] != p+n+1 {
+					found = false
+					break
+				}
+			}
+			if found {
+				counts[d.Number]++
+			}
+		}
+	}
+	return counts
+}
+
+// rank returns the numbers of the docs holding every phrase, the most
+// relevant first.
+func (x *index) rank(phrases ...string) []int {
+	total := 0
+	for _, d := range x.docs {
+		total += d.Length
+	}
+	avgLength := float64(total) / float64(len(x.docs))
+	lengths := map[int]int{}
+	for _, d := range x.docs {
+		lengths[d.Number] = d.Length
+	}
+	var scores map[int]float64
+	for _, p := range phrases {
+		counts := x.phrase(p)
+		next := map[int]float64{}
+		for number, count := range counts {
+			if previous, ok := scores[number]; ok || scores == nil {
+				next[number] = previous + BM25(count, lengths[number], len(x.docs), len(counts), avgLength)
+			}
+		}
+		scores = next
+	}
+	numbers := []int{}
+	for number := range scores {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(a, b int) bool {
+		if scores[numbers[a]] != scores[numbers[b]] {
+			return scores[numbers[a]] > scores[numbers[b]]
+		}
+		return numbers[a] < numbers[b]
+	})
+	return numbers
+}
+
+func TestPhrases(t *testing.T) {
+	x := newIndex(
+		issue.Issue{Number: 1, Title: "Index out of range", Body: "panic: runtime error: index out of range [3] with length 3"},
+		issue.Issue{Number: 2, Title: "Out of memory", Body: "the index is out of date"},
+		// a phrase doesn't span the title and the body, or two comments
+		issue.Issue{Number: 3, Title: "Crash in index", Body: "out of range", Comments: []issue.Comment{{Body: "runtime"}, {Body: "error again"}}},
+		issue.Issue{Number: 4, Title: "Ranges", Body: "Indexes out of ranges are checked"},
+	)
+	tests := []struct{ phrase, want string }{
+		{"index", "map[1:2 2:1 3:1 4:1]"},
+		{"index out of range", "map[1:2 4:1]"},
+		{"out of", "map[1:2 2:2 3:1 4:1]"},
+		{"out of date", "map[2:1]"},
+		{"runtime error", "map[1:1]"},
+		{"range index", "map[]"},
+		{"crash index out", "map[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(x.phrase(tt.phrase)); got != tt.want {
+			t.Errorf("phrase %q found %s, want %s", tt.phrase, got, tt.want)
+		}
+	}
+}
+
+func TestRanking(t *testing.T) {
+	x := newIndex(
+		issue.Issue{Number: 1, Title: "Crash on start", Body: "The app crashes on start, crashing every time"},
+		issue.Issue{Number: 2, Title: "Slow start", Body: "Starting takes a long time since the last update, then it crashes once in a while when the window opens on a second screen"},
+		issue.Issue{Number: 3, Title: "Crash", Body: "crash"},
+		issue.Issue{Number: 4, Title: "Docs", Body: "The docs should say how to start the app"},
+		issue.Issue{Number: 5, Title: "Flaky test", Body: "The start test is flaky"},
+	)
+	tests := []struct {
+		phrases []string
+		want    string
+	}{
+		// a short doc of nothing but the word beats the longer ones
+		{[]string{"crash"}, "[3 1 2]"},
+		// more occurrences beat fewer, shorter docs beat longer ones, so the
+		// long #2 with two ranks last
+		{[]string{"start"}, "[1 5 4 2]"},
+		// every word or phrase must be found
+		{[]string{"crash", "start"}, "[1 2]"},
+		{[]string{"flaky"}, "[5]"},
+		{[]string{"missing"}, "[]"},
+		{[]string{"crash on start"}, "[1]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(x.rank(tt.phrases...)); got != tt.want {
+			t.Errorf("rank %q = %s, want %s", tt.phrases, got, tt.want)
+		}
+	}
+}
+
+func TestBM25(t *testing.T) {
+	// one doc in ten holds the term once, at the average length:
+	// idf = ln(1 + 9.5/1.5), tf part = 1
+	if got, want := BM25(1, 10, 10, 1, 10), math.Log(1+9.5/1.5); math.Abs(got-want) > 1e-9 {
+		t.Errorf("BM25(1, 10, 10, 1, 10) = %f, want %f", got, want)
+	}
+	base := BM25(2, 10, 100, 10, 10)
+	for _, tt := range []struct {
+		name  string
+		score float64
+	}{
+		{"a more frequent term", BM25(3, 10, 100, 10, 10)},
+		{"a rarer term", BM25(2, 10, 100, 5, 10)},
+		{"a shorter doc", BM25(2, 5, 100, 10, 10)},
+	} {
+		if tt.score <= base {
+			t.Errorf("%s scores %f, not more than %f", tt.name, tt.score, base)
+		}
+	}
+	// the term frequency saturates
+	if BM25(100, 10, 100, 10, 10) > base*(k1+1) {
+		t.Errorf("BM25 doesn't saturate with the term frequency")
+	}
+	// a term in every doc still scores above zero
+	if s := BM25(1, 10, 10, 10, 10); s <= 0 {
+		t.Errorf("BM25 of a term in every doc = %f, want more than 0", s)
+	}
+	// an empty index doesn't divide by zero
+	if s := BM25(1, 0, 1, 1, 0); math.IsNaN(s) || math.IsInf(s, 0) {
+		t.Errorf("BM25 with no average length = %f", s)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	terms := map[string]bool{"crash": true}
+	text := "Steps:\n  1. open the app\n  2. it crashes\nThen it CRASHED again\nlast crash"
+	if got := fmt.Sprintf("%q", Snippets(text, terms, 2)); got != `["2. it crashes" "Then it CRASHED again"]` {
+		t.Errorf("Snippets = %s", got)
+	}
+	long := strings.Repeat("filler ", 20) + "the crash happened here" + strings.Repeat(" filler", 20)
+	got := Snippets(long, terms, 1)
+	if len(got) != 1 || len([]rune(got[0])) != maxSnippetLength+6 || !strings.Contains(got[0], "crash happened") ||
+		!strings.HasPrefix(got[0], "...") || !strings.HasSuffix(got[0], "...") {
+		t.Errorf("Snippets of a long line = %q, want it cut around the term with ... on both ends", got)
+	}
+}
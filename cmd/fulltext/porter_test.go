@@ -0,0 +1,151 @@
+package fulltext
+
+import "testing"
+
+// TestStem checks words of the vocabulary published with the reference
+// implementation, https://tartarus.org/martin/PorterStemmer/, and the
+// examples of Porter's paper against their stems.
+func TestStem(t *testing.T) {
+	tests := []struct{ word, stem string }{
+		// step 1a
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"caress", "caress"},
+		{"cats", "cat"},
+		// step 1b
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"bled", "bled"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"tanned", "tan"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"fizzed", "fizz"},
+		{"failing", "fail"},
+		{"filing", "file"},
+		// step 1c
+		{"happy", "happi"},
+		{"sky", "sky"},
+		// step 2
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"rational", "ration"},
+		{"valenci", "valenc"},
+		{"hesitanci", "hesit"},
+		{"digitizer", "digit"},
+		{"conformabli", "conform"},
+		{"radicalli", "radic"},
+		{"differentli", "differ"},
+		{"vileli", "vile"},
+		{"analogousli", "analog"},
+		{"vietnamization", "vietnam"},
+		{"predication", "predic"},
+		{"operator", "oper"},
+		{"feudalism", "feudal"},
+		{"decisiveness", "decis"},
+		{"hopefulness", "hope"},
+		{"callousness", "callous"},
+		{"formaliti", "formal"},
+		{"sensitiviti", "sensit"},
+		{"sensibiliti", "sensibl"},
+		// step 3
+		{"triplicate", "triplic"},
+		{"formative", "form"},
+		{"formalize", "formal"},
+		{"electriciti", "electr"},
+		{"electrical", "electr"},
+		{"hopeful", "hope"},
+		{"goodness", "good"},
+		// step 4
+		{"revival", "reviv"},
+		{"allowance", "allow"},
+		{"inference", "infer"},
+		{"airliner", "airlin"},
+		{"gyroscopic", "gyroscop"},
+		{"adjustable", "adjust"},
+		{"defensible", "defens"},
+		{"irritant", "irrit"},
+		{"replacement", "replac"},
+		{"adjustment", "adjust"},
+		{"dependent", "depend"},
+		{"adoption", "adopt"},
+		{"homologou", "homolog"},
+		{"communism", "commun"},
+		{"activate", "activ"},
+		{"angulariti", "angular"},
+		{"homologous", "homolog"},
+		{"effective", "effect"},
+		{"bowdlerize", "bowdler"},
+		// step 5
+		{"probate", "probat"},
+		{"rate", "rate"},
+		{"cease", "ceas"},
+		{"controll", "control"},
+		{"roll", "roll"},
+		// the start of the reference vocabulary
+		{"a", "a"},
+		{"aback", "aback"},
+		{"abandon", "abandon"},
+		{"abandoned", "abandon"},
+		{"abase", "abas"},
+		{"abash", "abash"},
+		{"abate", "abat"},
+		{"abated", "abat"},
+		{"abatement", "abat"},
+		{"abatements", "abat"},
+		{"abates", "abat"},
+		{"abbess", "abbess"},
+		{"abbey", "abbei"},
+		{"abbeys", "abbei"},
+		{"abbominable", "abbomin"},
+		{"abbot", "abbot"},
+		{"abbots", "abbot"},
+		{"abbreviated", "abbrevi"},
+		{"abed", "ab"},
+		{"abhor", "abhor"},
+		{"abhorred", "abhor"},
+		{"abhorrence", "abhorr"},
+		{"abhorrent", "abhorr"},
+		{"abide", "abid"},
+		{"abides", "abid"},
+		{"abilities", "abil"},
+		{"ability", "abil"},
+		{"abject", "abject"},
+		{"able", "abl"},
+		{"ablest", "ablest"},
+		{"abode", "abod"},
+		{"abominable", "abomin"},
+		{"abound", "abound"},
+		{"about", "about"},
+		{"above", "abov"},
+		// the words of the package doc and some issue vocabulary
+		{"connect", "connect"},
+		{"connected", "connect"},
+		{"connecting", "connect"},
+		{"connection", "connect"},
+		{"connections", "connect"},
+		{"generalizations", "gener"},
+		{"oscillators", "oscil"},
+		{"crash", "crash"},
+		{"crashes", "crash"},
+		{"crashed", "crash"},
+		{"crashing", "crash"},
+		// words the stemmer leaves alone
+		{"go", "go"},
+		{"v2", "v2"},
+		{"naïve", "naïve"},
+		{"Running", "Running"},
+	}
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.stem {
+			t.Errorf("Stem(%q) = %q, want %q", tt.word, got, tt.stem)
+		}
+	}
+}
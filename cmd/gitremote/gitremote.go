@@ -0,0 +1,181 @@
+package gitremote
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// remotes are the remote names checked for a GitHub url, in order. The
+// upstream remote wins as in a fork it points to the repo holding the issues.
+var remotes = []string{"upstream", "origin"}
+
+// Find walks up from dir looking for a git repository and returns the GitHub
+// owner and repo of its upstream or origin remote.
+func Find(dir string) (string, string, error) {
+	gitDir, err := FindGitDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	urls, err := readRemotes(configPath(gitDir))
+	if err != nil {
+		return "", "", err
+	}
+	for _, name := range remotes {
+		if url, ok := urls[name]; ok {
+			if owner, repo, ok := ParseURL(url); ok {
+				return owner, repo, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no GitHub origin or upstream remote found in %s", gitDir)
+}
+
+// FindGitDir walks up from dir to the first folder holding a .git entry and
+// returns the git directory. A .git file, as used by worktrees and submodules,
+// is followed to the directory named by its "gitdir:" line.
+func FindGitDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ".git")
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				return path, nil
+			}
+			return readGitFile(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not inside a git repository")
+		}
+		dir = parent
+	}
+}
+
+// readGitFile returns the git directory a .git file points to. Relative
+// paths are relative to the folder holding the .git file.
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("%s is not a valid .git file", path)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// configPath returns the config file for the git directory. Worktrees keep
+// a commondir file pointing to the main git directory holding the config.
+func configPath(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		gitDir = filepath.Clean(common)
+	}
+	return filepath.Join(gitDir, "config")
+}
+
+// readRemotes parses a git config file and returns the url of each remote.
+func readRemotes(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	urls := map[string]string{}
+	remote := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			remote = ""
+			section := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			name, sub, ok := strings.Cut(section, " ")
+			if ok && strings.EqualFold(name, "remote") {
+				remote = strings.Trim(strings.TrimSpace(sub), `"`)
+			}
+			continue
+		}
+		if remote == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "url") {
+			urls[remote] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// ParseURL returns the owner and repo of a GitHub remote url. It understands
+// the https, ssh, git and scp-like "git@github.com:owner/repo.git" forms.
+func ParseURL(url string) (string, string, bool) {
+	var path string
+	if scheme, rest, ok := strings.Cut(url, "://"); ok {
+		switch scheme {
+		case "https", "http", "ssh", "git", "git+ssh":
+		default:
+			return "", "", false
+		}
+		host, p, ok := strings.Cut(rest, "/")
+		if !ok {
+			return "", "", false
+		}
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		if !isGitHub(host) {
+			return "", "", false
+		}
+		path = p
+	} else {
+		// scp-like syntax: [user@]host:owner/repo
+		host, p, ok := strings.Cut(url, ":")
+		if !ok {
+			return "", "", false
+		}
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		if !isGitHub(host) {
+			return "", "", false
+		}
+		path = p
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// isGitHub reports whether host is github.com, including the ssh.github.com
+// host used for ssh over the https port.
+func isGitHub(host string) bool {
+	host = strings.ToLower(host)
+	return host == "github.com" || host == "www.github.com" || host == "ssh.github.com"
+}
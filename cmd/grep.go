@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// grep flags
+var grepState string
+var grepIgnoreCase bool
+var grepList bool
+var grepCount bool
+var grepContext int
+
+// grepCmd represents the grep command
+var grepCmd = &cobra.Command{
+	Use:   "grep <pattern>",
+	Short: "Search the issues of the repo with a regular expression.",
+	Long: `Print the lines of the titles, bodies and comments of the stored issues that
+match a Go regular expression, see https://golang.org/s/re2syntax. Each line
+is prefixed with where it was found:
+
+	#12 (title):Crash on start
+	#12:panic: runtime error: index out of range
+	#12 (comment by alice at 2025-01-02 15:04):same panic here
+
+The lines are matched one at a time, -C adds lines of context around them.
+The issues are read one at a time, so it works on repos of any size.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("You need to give one pattern!")
+			os.Exit(-1)
+		}
+		g, err := newGrepper(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		openStore()
+		if err := g.grep(db); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// grepper prints the lines of issues matching a regular expression.
+type grepper struct {
+	re      *regexp.Regexp
+	context int
+	// printed is set once lines were printed, to separate the next ones
+	printed bool
+}
+
+// newGrepper returns a grepper printing the lines matching pattern, as asked
+// for by the grep flags.
+func newGrepper(pattern string) (*grepper, error) {
+	if grepIgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if grepContext < 0 {
+		return nil, fmt.Errorf("-C wants a number of lines, not %d", grepContext)
+	}
+	return &grepper{re: re, context: grepContext}, nil
+}
+
+// grep prints the matching lines of the issues of the store with the state
+// of --state, read one at a time.
+func (g *grepper) grep(s storage.Storage) error {
+	return s.Each(grepState, true, func(i issue.Issue) error {
+		g.grepIssue(i)
+		return nil
+	})
+}
+
+// grepSource is a title, body or comment searched, with the prefix of its
+// lines.
+type grepSource struct {
+	where string
+	text  string
+}
+
+// grepIssue prints the matching lines of the title, body and comments of the
+// issue, its number when -l is given or the number of lines with --count.
+func (g *grepper) grepIssue(i issue.Issue) {
+	prefix := fmt.Sprintf("#%d", i.Number)
+	sources := []grepSource{
+		{prefix + " (title)", i.Title},
+		{prefix, i.Body},
+	}
+	for _, c := range i.Comments {
+		where := fmt.Sprintf("%s (comment by %s at %s)", prefix, c.User.Login, c.CreatedAt.In(time.Local).Format("2006-01-02 15:04"))
+		sources = append(sources, grepSource{where, c.Body})
+	}
+	count := 0
+	for _, s := range sources {
+		matches := g.match(s.text)
+		if len(matches) == 0 {
+			continue
+		}
+		if grepList {
+			fmt.Println(i.Number)
+			return
+		}
+		count += len(matches)
+		if !grepCount {
+			g.print(s.where, s.text, matches)
+		}
+	}
+	if grepCount && count > 0 {
+		fmt.Printf("%s:%d\n", prefix, count)
+	}
+}
+
+// match returns the indexes of the lines of the text matching.
+func (g *grepper) match(text string) []int {
+	if text == "" {
+		return nil
+	}
+	matches := []int{}
+	for n, line := range splitLines(text) {
+		if g.re.MatchString(line) {
+			matches = append(matches, n)
+		}
+	}
+	return matches
+}
+
+// print prints the matching lines of the text with their context, like grep:
+// matching lines follow the prefix with a colon, context lines with a dash,
+// and -- separates lines that don't follow each other.
+func (g *grepper) print(where string, text string, matches []int) {
+	all := splitLines(text)
+	matched := map[int]bool{}
+	shown := make([]bool, len(all))
+	for _, m := range matches {
+		matched[m] = true
+		for n := max(0, m-g.context); n <= min(len(all)-1, m+g.context); n++ {
+			shown[n] = true
+		}
+	}
+	last := -1
+	for n, line := range all {
+		if !shown[n] {
+			continue
+		}
+		if g.context > 0 && g.printed && (last == -1 || n != last+1) {
+			fmt.Println("--")
+		}
+		sep := "-"
+		if matched[n] {
+			sep = ":"
+		}
+		fmt.Printf("%s%s%s\n", where, sep, line)
+		last = n
+		g.printed = true
+	}
+}
+
+// splitLines splits text into lines, without the carriage returns GitHub keeps.
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// init registers the grep command with the root command and sets up flags on
+// the grep command.
+func init() {
+	RootCmd.AddCommand(grepCmd)
+	grepCmd.Flags().StringVarP(&grepState, "state", "s", "all", "Search issues by their state <all, closed, open>")
+	grepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "i", false, "Match upper and lower case alike")
+	grepCmd.Flags().BoolVarP(&grepList, "files-with-matches", "l", false, "Only print the numbers of the issues with matching lines")
+	grepCmd.Flags().BoolVarP(&grepCount, "count", "c", false, "Only print the number of matching lines of each issue")
+	grepCmd.Flags().IntVarP(&grepContext, "context", "C", 0, "Print this many lines of context around matching lines")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+)
+
+// grepFlags sets the grep flags for a test.
+func grepFlags(t *testing.T, state string, ignoreCase bool, list bool, count bool, context int) {
+	t.Helper()
+	t.Cleanup(func() {
+		grepState, grepIgnoreCase, grepList, grepCount, grepContext = "all", false, false, false, 0
+	})
+	grepState, grepIgnoreCase, grepList, grepCount, grepContext = state, ignoreCase, list, count, context
+}
+
+// grepStore returns a store holding issues to grep.
+func grepStore(t *testing.T) storage.Storage {
+	t.Helper()
+	root, err := bolt.OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { root.Close() })
+	s, err := root.ForRepo("octo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := []issue.Issue{
+		{
+			Number: 1, State: "open", Title: "Crash on start",
+			Body: "Steps:\r\n1. open the app\r\n2. it crashes\r\n3. restart\r\n4. it crashes again\r\n5. give up",
+			Comments: []issue.Comment{{
+				ID:        1,
+				User:      issue.User{Login: "alice"},
+				Body:      "it crashed for me too",
+				CreatedAt: time.Date(2025, 1, 2, 15, 4, 0, 0, time.Local),
+			}},
+		},
+		{
+			Number: 2, State: "closed", Title: "Slow start",
+			Body: "CRASH once",
+			Comments: []issue.Comment{{
+				ID:        2,
+				User:      issue.User{Login: "bob"},
+				Body:      "no crash here",
+				CreatedAt: time.Date(2025, 1, 3, 9, 0, 0, 0, time.Local),
+			}},
+		},
+		{Number: 3, State: "open", Title: "Docs", Body: "nothing to see"},
+	}
+	for _, i := range issues {
+		if err := s.Save(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestGrep(t *testing.T) {
+	s := grepStore(t)
+	tests := []struct {
+		name       string
+		pattern    string
+		state      string
+		ignoreCase bool
+		list       bool
+		count      bool
+		context    int
+		want       string
+	}{
+		{
+			name: "lines", pattern: "crash", state: "all",
+			want: `#1:2. it crashes
+#1:4. it crashes again
+#1 (comment by alice at 2025-01-02 15:04):it crashed for me too
+#2 (comment by bob at 2025-01-03 09:00):no crash here
+`,
+		},
+		{
+			name: "-i", pattern: "crash", state: "all", ignoreCase: true,
+			want: `#1 (title):Crash on start
+#1:2. it crashes
+#1:4. it crashes again
+#1 (comment by alice at 2025-01-02 15:04):it crashed for me too
+#2:CRASH once
+#2 (comment by bob at 2025-01-03 09:00):no crash here
+`,
+		},
+		{
+			name: "-l", pattern: "crash", state: "all", ignoreCase: true, list: true,
+			want: "1\n2\n",
+		},
+		{
+			name: "--count", pattern: "crash", state: "all", ignoreCase: true, count: true,
+			want: "#1:4\n#2:2\n",
+		},
+		{
+			name: "--state closed", pattern: "crash", state: "closed", ignoreCase: true,
+			want: `#2:CRASH once
+#2 (comment by bob at 2025-01-03 09:00):no crash here
+`,
+		},
+		{
+			name: "--state open -l", pattern: "start", state: "open", list: true,
+			want: "1\n",
+		},
+		{
+			name: "-C joins overlapping context", pattern: "crashes", state: "all", context: 1,
+			want: `#1-1. open the app
+#1:2. it crashes
+#1-3. restart
+#1:4. it crashes again
+#1-5. give up
+`,
+		},
+		{
+			name: "-C separates lines apart", pattern: `^[15]\.`, state: "all", context: 1,
+			want: `#1-Steps:
+#1:1. open the app
+#1-2. it crashes
+--
+#1-4. it crashes again
+#1:5. give up
+`,
+		},
+		{
+			name: "-C separates sources and issues", pattern: "crash", state: "all", ignoreCase: true, context: 1,
+			want: `#1 (title):Crash on start
+--
+#1-1. open the app
+#1:2. it crashes
+#1-3. restart
+#1:4. it crashes again
+#1-5. give up
+--
+#1 (comment by alice at 2025-01-02 15:04):it crashed for me too
+--
+#2:CRASH once
+--
+#2 (comment by bob at 2025-01-03 09:00):no crash here
+`,
+		},
+		{
+			name: "no match", pattern: "missing", state: "all", context: 2,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grepFlags(t, tt.state, tt.ignoreCase, tt.list, tt.count, tt.context)
+			g, err := newGrepper(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var grepErr error
+			got := capture(t, func() { grepErr = g.grep(s) })
+			if grepErr != nil {
+				t.Fatal(grepErr)
+			}
+			if got != tt.want {
+				t.Errorf("grep %q printed:\n%s\nwant:\n%s", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGrepper(t *testing.T) {
+	grepFlags(t, "all", false, false, false, 0)
+	if _, err := newGrepper("(crash"); err == nil {
+		t.Errorf("newGrepper of a broken pattern succeeded")
+	}
+	grepFlags(t, "all", false, false, false, -1)
+	if _, err := newGrepper("crash"); err == nil || err.Error() != "-C wants a number of lines, not -1" {
+		t.Errorf("newGrepper with -C -1 = %v, want an error", err)
+	}
+}
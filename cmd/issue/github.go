@@ -0,0 +1,195 @@
+package issue
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// FromGitHub converts an issue returned by the GitHub API. Its comments and
+// pull request data are fetched separately, see CommentsFromGitHub and
+// NewPullRequest.
+func FromGitHub(gi *github.Issue) Issue {
+	i := Issue{
+		Version:      FormatVersion,
+		Number:       gi.GetNumber(),
+		Title:        gi.GetTitle(),
+		Body:         gi.GetBody(),
+		State:        gi.GetState(),
+		User:         UserFromGitHub(gi.User),
+		Milestone:    MilestoneFromGitHub(gi.Milestone),
+		Locked:       gi.GetLocked(),
+		CommentCount: gi.GetComments(),
+		Reactions:    ReactionsFromGitHub(gi.Reactions),
+		CreatedAt:    gi.GetCreatedAt(),
+		UpdatedAt:    gi.GetUpdatedAt(),
+		ClosedAt:     gi.ClosedAt,
+		URL:          gi.GetHTMLURL(),
+		IsPull:       gi.IsPullRequest(),
+	}
+	if gi.ClosedBy != nil {
+		u := UserFromGitHub(gi.ClosedBy)
+		i.ClosedBy = &u
+	}
+	for _, l := range gi.Labels {
+		i.Labels = append(i.Labels, LabelFromGitHub(l))
+	}
+	for _, a := range gi.Assignees {
+		i.Assignees = append(i.Assignees, UserFromGitHub(a))
+	}
+	return i
+}
+
+// CommentFromGitHub converts an issue comment returned by the GitHub API.
+func CommentFromGitHub(c *github.IssueComment) Comment {
+	return Comment{
+		ID:          c.GetID(),
+		User:        UserFromGitHub(c.User),
+		Body:        c.GetBody(),
+		CreatedAt:   c.GetCreatedAt(),
+		UpdatedAt:   c.GetUpdatedAt(),
+		URL:         c.GetHTMLURL(),
+		Reactions:   ReactionsFromGitHub(c.Reactions),
+		Association: c.GetAuthorAssociation(),
+	}
+}
+
+// CommentsFromGitHub converts the comments of an issue returned by the GitHub
+// API, skipping missing ones.
+func CommentsFromGitHub(gcs []*github.IssueComment) []Comment {
+	comments := []Comment{}
+	for _, c := range gcs {
+		if c != nil {
+			comments = append(comments, CommentFromGitHub(c))
+		}
+	}
+	return comments
+}
+
+// GitHubEvent is an event of an issue's timeline returned by the GitHub API.
+// It decodes the issue that a cross-reference comes from, which
+// github.Timeline leaves out.
+type GitHubEvent struct {
+	github.Timeline
+	Source *struct {
+		Type  string        `json:"type"`
+		Issue *github.Issue `json:"issue"`
+	} `json:"source,omitempty"`
+}
+
+// EventsFromGitHub converts the timeline of an issue returned by the GitHub
+// API, keeping the kinds of events listed in EventTypes.
+func EventsFromGitHub(ges []*GitHubEvent) []Event {
+	events := []Event{}
+	for _, e := range ges {
+		if e == nil || !slices.Contains(EventTypes, e.GetEvent()) {
+			continue
+		}
+		ev := Event{
+			Type:      e.GetEvent(),
+			Actor:     UserFromGitHub(e.Actor),
+			CreatedAt: e.GetCreatedAt(),
+			Label:     e.GetLabel().GetName(),
+			Assignee:  e.GetAssignee().GetLogin(),
+			Milestone: e.GetMilestone().GetTitle(),
+			Commit:    e.GetCommitID(),
+			From:      e.GetRename().GetFrom(),
+			To:        e.GetRename().GetTo(),
+		}
+		if e.Source != nil && e.Source.Issue != nil {
+			si := e.Source.Issue
+			ev.Source = &Reference{
+				Repo:   strings.TrimPrefix(si.GetRepositoryURL(), "https://api.github.com/repos/"),
+				Number: si.GetNumber(),
+				Title:  si.GetTitle(),
+				IsPull: si.IsPullRequest(),
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// UserFromGitHub converts a user returned by the GitHub API, a missing user,
+// like the author of a deleted account's issues, has an empty login.
+func UserFromGitHub(u *github.User) User {
+	return User{Login: u.GetLogin()}
+}
+
+// ReactionsFromGitHub converts the reaction counts returned by the GitHub API,
+// nil when there are none.
+func ReactionsFromGitHub(r *github.Reactions) *Reactions {
+	if r == nil {
+		return nil
+	}
+	return &Reactions{
+		Total:    r.GetTotalCount(),
+		PlusOne:  r.GetPlusOne(),
+		MinusOne: r.GetMinusOne(),
+		Laugh:    r.GetLaugh(),
+		Confused: r.GetConfused(),
+		Heart:    r.GetHeart(),
+		Hooray:   r.GetHooray(),
+	}
+}
+
+// LabelFromGitHub converts a label returned by the GitHub API.
+func LabelFromGitHub(l github.Label) Label {
+	return Label{Name: l.GetName(), Color: l.GetColor(), Description: l.GetDescription()}
+}
+
+// MilestoneFromGitHub converts a milestone returned by the GitHub API, it
+// returns nil for an issue without milestone.
+func MilestoneFromGitHub(m *github.Milestone) *Milestone {
+	if m == nil {
+		return nil
+	}
+	return &Milestone{Number: m.GetNumber(), Title: m.GetTitle(), State: m.GetState(), DueOn: m.DueOn}
+}
+
+// NewPullRequest copies the branch and merge details of a GitHub pull request.
+func NewPullRequest(pr *github.PullRequest) *PullRequest {
+	p := &PullRequest{
+		Head:           pr.GetHead().GetLabel(),
+		Base:           pr.GetBase().GetLabel(),
+		HeadSHA:        pr.GetHead().GetSHA(),
+		Merged:         pr.GetMerged(),
+		MergedAt:       pr.MergedAt,
+		Mergeable:      pr.Mergeable,
+		MergeableState: pr.GetMergeableState(),
+		Commits:        pr.GetCommits(),
+		Additions:      pr.GetAdditions(),
+		Deletions:      pr.GetDeletions(),
+		ChangedFiles:   pr.GetChangedFiles(),
+	}
+	if pr.MergedBy != nil {
+		u := UserFromGitHub(pr.MergedBy)
+		p.MergedBy = &u
+	}
+	return p
+}
+
+// ReviewFromGitHub converts a pull request review returned by the GitHub API.
+func ReviewFromGitHub(r *github.PullRequestReview) Review {
+	return Review{
+		ID:          r.GetID(),
+		User:        UserFromGitHub(r.User),
+		State:       r.GetState(),
+		Body:        r.GetBody(),
+		SubmittedAt: r.SubmittedAt,
+	}
+}
+
+// ReviewCommentFromGitHub converts a pull request review comment returned by
+// the GitHub API.
+func ReviewCommentFromGitHub(c *github.PullRequestComment) ReviewComment {
+	return ReviewComment{
+		ID:        c.GetID(),
+		User:      UserFromGitHub(c.User),
+		Path:      c.GetPath(),
+		DiffHunk:  c.GetDiffHunk(),
+		Body:      c.GetBody(),
+		CreatedAt: c.GetCreatedAt(),
+	}
+}
@@ -2,20 +2,247 @@ package issue
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/google/go-github/github"
 )
 
+// FormatVersion is the version of the issue format, stored with every issue.
+// It is bumped, together with storage.SchemaVersion, when a change to these
+// types needs the stored issues to be migrated.
+const FormatVersion = 1
+
+// Issue is an issue or pull request as ogi stores it. It doesn't depend on
+// the GitHub client library, use FromGitHub to convert the issues it returns.
 type Issue struct {
-	github.Issue
-	Comments []*github.IssueComment
+	Version      int        `json:"version"`
+	Number       int        `json:"number"`
+	Title        string     `json:"title"`
+	Body         string     `json:"body,omitempty"`
+	State        string     `json:"state"`
+	User         User       `json:"user"`
+	Labels       []Label    `json:"labels,omitempty"`
+	Assignees    []User     `json:"assignees,omitempty"`
+	Milestone    *Milestone `json:"milestone,omitempty"`
+	Locked       bool       `json:"locked,omitempty"`
+	CommentCount int        `json:"comment_count"`
+	Reactions    *Reactions `json:"reactions,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	ClosedBy     *User      `json:"closed_by,omitempty"`
+	URL          string     `json:"url,omitempty"`
+	// IsPull is set for pull requests, PullRequest only holds their review
+	// data when the repo was fetched with --pulls.
+	IsPull      bool         `json:"is_pull,omitempty"`
+	Comments    []Comment    `json:"comments,omitempty"`
+	PullRequest *PullRequest `json:"pull_request,omitempty"`
+	// Events is the timeline of the issue without its comments, oldest
+	// first. Issues fetched before ogi stored it have none.
+	Events []Event `json:"events,omitempty"`
+}
+
+// Comment is a comment on an issue.
+type Comment struct {
+	ID        int64      `json:"id"`
+	User      User       `json:"user"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	URL       string     `json:"url,omitempty"`
+	Reactions *Reactions `json:"reactions,omitempty"`
+	// Association is the author's relationship to the repo, like OWNER,
+	// MEMBER, COLLABORATOR or NONE.
+	Association string `json:"author_association,omitempty"`
+}
+
+// User is the author of an issue or comment.
+type User struct {
+	Login string `json:"login"`
+}
+
+// Label is a label attached to an issue.
+type Label struct {
+	Name        string `json:"name"`
+	Color       string `json:"color,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Reactions counts the emoji reactions to an issue. Total also counts the
+// kinds GitHub added after the ones listed.
+type Reactions struct {
+	Total    int `json:"total"`
+	PlusOne  int `json:"+1,omitempty"`
+	MinusOne int `json:"-1,omitempty"`
+	Laugh    int `json:"laugh,omitempty"`
+	Confused int `json:"confused,omitempty"`
+	Heart    int `json:"heart,omitempty"`
+	Hooray   int `json:"hooray,omitempty"`
+}
+
+// Milestone is the milestone an issue belongs to.
+type Milestone struct {
+	Number int        `json:"number"`
+	Title  string     `json:"title"`
+	State  string     `json:"state,omitempty"`
+	DueOn  *time.Time `json:"due_on,omitempty"`
+}
+
+// PullRequest holds the review data of an issue that is a pull request. It is
+// only filled in when the repo was fetched with --pulls.
+type PullRequest struct {
+	Head           string          `json:"head"`
+	Base           string          `json:"base"`
+	HeadSHA        string          `json:"head_sha"`
+	Merged         bool            `json:"merged"`
+	MergedAt       *time.Time      `json:"merged_at,omitempty"`
+	MergedBy       *User           `json:"merged_by,omitempty"`
+	Mergeable      *bool           `json:"mergeable,omitempty"`
+	MergeableState string          `json:"mergeable_state,omitempty"`
+	Commits        int             `json:"commits,omitempty"`
+	Additions      int             `json:"additions,omitempty"`
+	Deletions      int             `json:"deletions,omitempty"`
+	ChangedFiles   int             `json:"changed_files,omitempty"`
+	Reviews        []Review        `json:"reviews,omitempty"`
+	ReviewComments []ReviewComment `json:"review_comments,omitempty"`
+	Diff           string          `json:"diff,omitempty"`
+}
+
+// Review is the summary of a pull request review.
+type Review struct {
+	ID          int64      `json:"id"`
+	User        User       `json:"user"`
+	State       string     `json:"state"`
+	Body        string     `json:"body,omitempty"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+}
+
+// ReviewComment is a comment on a line of a pull request's diff.
+type ReviewComment struct {
+	ID        int64     `json:"id"`
+	User      User      `json:"user"`
+	Path      string    `json:"path"`
+	DiffHunk  string    `json:"diff_hunk,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExpectedComments returns the number of comments GitHub reported for the
+// issue when it was fetched.
+func (i Issue) ExpectedComments() int {
+	return i.CommentCount
+}
+
+// ReactionCount returns the number of reactions to the issue, zero for issues
+// fetched before ogi stored them.
+func (i Issue) ReactionCount() int {
+	if i.Reactions == nil {
+		return 0
+	}
+	return i.Reactions.Total
+}
+
+// ReactionCount returns the number of reactions to the comment, zero for
+// comments fetched before ogi stored them.
+func (c Comment) ReactionCount() int {
+	if c.Reactions == nil {
+		return 0
+	}
+	return c.Reactions.Total
+}
+
+// MissingComments returns how many of the reported comments are not stored.
+func (i Issue) MissingComments() int {
+	if missing := i.ExpectedComments() - len(i.Comments); missing > 0 {
+		return missing
+	}
+	return 0
+}
+
+// mentionPatterns holds the compiled mentionPattern of each login, as
+// Mentions is called for every issue of a search.
+var mentionPatterns sync.Map
+
+// mentionPattern returns the regexp matching an @mention of the login.
+func mentionPattern(login string) *regexp.Regexp {
+	if p, ok := mentionPatterns.Load(login); ok {
+		return p.(*regexp.Regexp)
+	}
+	p := regexp.MustCompile(`(?i)(^|[^\w@])@` + regexp.QuoteMeta(login) + `($|[^\w-])`)
+	mentionPatterns.Store(login, p)
+	return p
+}
+
+// Mentions reports whether the user with the given login is @mentioned in
+// the body of the issue or in its loaded comments.
+func (i Issue) Mentions(login string) bool {
+	mention := mentionPattern(login)
+	if mention.MatchString(i.Body) {
+		return true
+	}
+	for _, c := range i.Comments {
+		if mention.MatchString(c.Body) {
+			return true
+		}
+	}
+	return false
 }
 
 func (i Issue) FmtTitle() string {
-	return fmt.Sprintf("%d\t%s\n", *i.Number, *i.Title)
+	return fmt.Sprintf("%d\t%s\n", i.Number, i.Title)
 }
 
 func (i Issue) FmtByLine() string {
-	return fmt.Sprintf("\tCreated %s by %s\n\tState: %s\n", i.CreatedAt.In(time.Local), *i.User.Login, *i.State)
+	return fmt.Sprintf("\tCreated %s by %s\n\tState: %s\n", i.CreatedAt.In(time.Local), i.User.Login, i.State)
+}
+
+// FmtLabels returns the names of the labels, as printed by show.
+func (i Issue) FmtLabels() string {
+	names := make([]string, len(i.Labels))
+	for n, l := range i.Labels {
+		names[n] = l.Name
+	}
+	return fmt.Sprint(names)
+}
+
+// FmtReactions returns the count of each kind of reaction, as GitHub shows
+// them under a comment.
+func (r Reactions) FmtReactions() string {
+	kinds := []struct {
+		emoji string
+		count int
+	}{
+		{"👍", r.PlusOne}, {"👎", r.MinusOne}, {"😄", r.Laugh},
+		{"😕", r.Confused}, {"❤️", r.Heart}, {"🎉", r.Hooray},
+	}
+	counts := []string{}
+	listed := 0
+	for _, k := range kinds {
+		if k.count > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", k.emoji, k.count))
+			listed += k.count
+		}
+	}
+	if other := r.Total - listed; other > 0 {
+		counts = append(counts, fmt.Sprintf("+%d more", other))
+	}
+	return strings.Join(counts, "  ")
+}
+
+// FmtPullRequest returns the branch, merge and size details of a pull request.
+func (p PullRequest) FmtPullRequest() string {
+	s := fmt.Sprintf("\tPull Request: %s into %s\n", p.Head, p.Base)
+	switch {
+	case p.Merged && p.MergedAt != nil && p.MergedBy != nil:
+		s += fmt.Sprintf("\tMerged %s by %s\n", p.MergedAt.In(time.Local), p.MergedBy.Login)
+	case p.Merged && p.MergedAt != nil:
+		s += fmt.Sprintf("\tMerged %s\n", p.MergedAt.In(time.Local))
+	case p.Mergeable != nil && *p.Mergeable:
+		s += fmt.Sprintf("\tMergeable (%s)\n", p.MergeableState)
+	case p.Mergeable != nil:
+		s += fmt.Sprintf("\tNot mergeable (%s)\n", p.MergeableState)
+	}
+	s += fmt.Sprintf("\t%d commits, %d files changed, +%d -%d\n", p.Commits, p.ChangedFiles, p.Additions, p.Deletions)
+	return s
 }
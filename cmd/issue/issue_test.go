@@ -0,0 +1,35 @@
+package issue
+
+import "testing"
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"cc @alice", true},
+		{"@alice can you look?", true},
+		{"thanks @ALICE.", true},
+		{"(@alice)", true},
+		{"ping @alice-bob", false},
+		{"ping @alice_b", false},
+		{"ping @alicex", false},
+		{"mail alice@example.com", false},
+		{"@@alice", false},
+		{"alice", false},
+	}
+	for _, tt := range tests {
+		if got := (Issue{Body: tt.body}).Mentions("alice"); got != tt.want {
+			t.Errorf("Mentions(alice) in %q = %t, want %t", tt.body, got, tt.want)
+		}
+		if got := (Issue{Comments: []Comment{{Body: "no"}, {Body: tt.body}}}).Mentions("alice"); got != tt.want {
+			t.Errorf("Mentions(alice) in a comment %q = %t, want %t", tt.body, got, tt.want)
+		}
+	}
+	if !(Issue{Body: "cc @a.b"}).Mentions("a.b") || (Issue{Body: "cc @axb"}).Mentions("a.b") {
+		t.Errorf("Mentions doesn't quote the login")
+	}
+	if mentionPattern("alice") != mentionPattern("alice") {
+		t.Errorf("the pattern of a login is compiled more than once")
+	}
+}
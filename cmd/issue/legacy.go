@@ -0,0 +1,92 @@
+package issue
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// legacyIssue is the format issues were stored in before ogi had its own
+// issue types: the go-github v17 issue with its comments and pull request.
+type legacyIssue struct {
+	github.Issue
+	Comments    []*github.IssueComment
+	PullRequest *legacyPullRequest `json:",omitempty"`
+}
+
+type legacyPullRequest struct {
+	Head           string
+	Base           string
+	HeadSHA        string
+	Merged         bool
+	MergedAt       *time.Time
+	MergedBy       *github.User
+	Mergeable      *bool
+	MergeableState string
+	Commits        int
+	Additions      int
+	Deletions      int
+	ChangedFiles   int
+	Reviews        []*github.PullRequestReview
+	ReviewComments []*github.PullRequestComment
+	Diff           string
+}
+
+// IsLegacy reports whether data is an issue stored before ogi had its own
+// issue format, which has no version.
+func IsLegacy(data []byte) bool {
+	var v struct {
+		Version int `json:"version"`
+	}
+	return json.Unmarshal(data, &v) == nil && v.Version == 0
+}
+
+// FromLegacy converts an issue stored before ogi had its own issue format.
+func FromLegacy(data []byte) (Issue, error) {
+	li := legacyIssue{}
+	if err := json.Unmarshal(data, &li); err != nil {
+		return Issue{}, err
+	}
+	i := FromGitHub(&li.Issue)
+	if li.Comments != nil {
+		i.Comments = CommentsFromGitHub(li.Comments)
+	}
+	if lp := li.PullRequest; lp != nil {
+		i.PullRequest = &PullRequest{
+			Head:           lp.Head,
+			Base:           lp.Base,
+			HeadSHA:        lp.HeadSHA,
+			Merged:         lp.Merged,
+			MergedAt:       lp.MergedAt,
+			Mergeable:      lp.Mergeable,
+			MergeableState: lp.MergeableState,
+			Commits:        lp.Commits,
+			Additions:      lp.Additions,
+			Deletions:      lp.Deletions,
+			ChangedFiles:   lp.ChangedFiles,
+			Diff:           lp.Diff,
+		}
+		if lp.MergedBy != nil {
+			u := UserFromGitHub(lp.MergedBy)
+			i.PullRequest.MergedBy = &u
+		}
+		for _, r := range lp.Reviews {
+			i.PullRequest.Reviews = append(i.PullRequest.Reviews, ReviewFromGitHub(r))
+		}
+		for _, c := range lp.ReviewComments {
+			i.PullRequest.ReviewComments = append(i.PullRequest.ReviewComments, ReviewCommentFromGitHub(c))
+		}
+	}
+	return i, nil
+}
+
+// CommentsFromLegacy converts comments stored on their own before ogi had its
+// own issue format.
+func CommentsFromLegacy(data []byte) ([]Comment, error) {
+	gcs := []*github.IssueComment{}
+	if err := json.Unmarshal(data, &gcs); err != nil {
+		return nil, err
+	}
+	return CommentsFromGitHub(gcs), nil
+}
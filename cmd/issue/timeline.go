@@ -0,0 +1,162 @@
+package issue
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Event is an event of an issue's timeline, like a label added, the issue
+// closed or a reference to it from another issue.
+type Event struct {
+	// Type is the event's name in the GitHub API, like labeled or closed.
+	Type      string    `json:"type"`
+	Actor     User      `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+	Label     string    `json:"label,omitempty"`
+	Assignee  string    `json:"assignee,omitempty"`
+	Milestone string    `json:"milestone,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	// From and To are the titles of a renamed issue.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Source is the issue or pull request of a cross-reference.
+	Source *Reference `json:"source,omitempty"`
+}
+
+// Reference is an issue or pull request referring to another one.
+type Reference struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	Title  string `json:"title,omitempty"`
+	IsPull bool   `json:"is_pull,omitempty"`
+}
+
+// EventTypes are the kinds of timeline events ogi stores, the others, like
+// subscribed or mentioned, don't tell anything about the conversation.
+var EventTypes = []string{
+	"assigned", "unassigned", "labeled", "unlabeled", "milestoned",
+	"demilestoned", "renamed", "closed", "reopened", "merged", "locked",
+	"unlocked", "referenced", "cross-referenced",
+}
+
+// Describe returns what happened, to follow the login of the actor.
+func (e Event) Describe() string {
+	switch e.Type {
+	case "assigned":
+		if e.Assignee == e.Actor.Login {
+			return "self-assigned this"
+		}
+		return "assigned " + e.Assignee
+	case "unassigned":
+		if e.Assignee == e.Actor.Login {
+			return "removed their assignment"
+		}
+		return "unassigned " + e.Assignee
+	case "labeled":
+		return fmt.Sprintf("added the %s label", e.Label)
+	case "unlabeled":
+		return fmt.Sprintf("removed the %s label", e.Label)
+	case "milestoned":
+		return fmt.Sprintf("added this to the %s milestone", e.Milestone)
+	case "demilestoned":
+		return fmt.Sprintf("removed this from the %s milestone", e.Milestone)
+	case "renamed":
+		return fmt.Sprintf("changed the title from %q to %q", e.From, e.To)
+	case "closed":
+		if e.Commit != "" {
+			return "closed this in " + shortSHA(e.Commit)
+		}
+		return "closed this"
+	case "merged":
+		if e.Commit != "" {
+			return "merged this in " + shortSHA(e.Commit)
+		}
+		return "merged this"
+	case "referenced":
+		return "referenced this in commit " + shortSHA(e.Commit)
+	case "cross-referenced":
+		if e.Source == nil {
+			return "mentioned this"
+		}
+		s := fmt.Sprintf("mentioned this in %s#%d", e.Source.Repo, e.Source.Number)
+		if e.Source.Title != "" {
+			s += " " + e.Source.Title
+		}
+		return s
+	}
+	// reopened, locked, unlocked and kinds added later
+	return e.Type + " this"
+}
+
+// shortSHA returns the abbreviated form of a commit SHA.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// IsMaintainer reports whether the author of the comment owns the repo or
+// is a member or collaborator of it.
+func (c Comment) IsMaintainer() bool {
+	switch c.Association {
+	case "OWNER", "MEMBER", "COLLABORATOR":
+		return true
+	}
+	return false
+}
+
+// Maintainers returns the logins of the people known to maintain the repo
+// from the issue's loaded comments and events: comment authors associated
+// with the repo, and whoever labeled, assigned or merged it, which needs
+// write or triage access.
+func (i Issue) Maintainers() map[string]bool {
+	maintainers := map[string]bool{}
+	for _, c := range i.Comments {
+		if c.IsMaintainer() {
+			maintainers[c.User.Login] = true
+		}
+	}
+	for _, e := range i.Events {
+		switch e.Type {
+		case "assigned", "unassigned", "labeled", "unlabeled", "milestoned", "demilestoned", "merged", "locked", "unlocked":
+			maintainers[e.Actor.Login] = true
+		}
+	}
+	delete(maintainers, "")
+	return maintainers
+}
+
+// Entry is one comment, review or event of an issue's conversation, only
+// one of them is set.
+type Entry struct {
+	Time    time.Time
+	Comment *Comment
+	Review  *Review
+	Event   *Event
+}
+
+// Conversation returns the loaded comments, the reviews of a pull request
+// and the events of the issue, oldest first.
+func (i Issue) Conversation() []Entry {
+	entries := []Entry{}
+	for n := range i.Comments {
+		entries = append(entries, Entry{Time: i.Comments[n].CreatedAt, Comment: &i.Comments[n]})
+	}
+	if i.PullRequest != nil {
+		for n, r := range i.PullRequest.Reviews {
+			// pending reviews aren't submitted yet
+			if r.SubmittedAt != nil {
+				entries = append(entries, Entry{Time: *r.SubmittedAt, Review: &i.PullRequest.Reviews[n]})
+			}
+		}
+	}
+	for n := range i.Events {
+		entries = append(entries, Entry{Time: i.Events[n].CreatedAt, Event: &i.Events[n]})
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Time.Before(entries[b].Time)
+	})
+	return entries
+}
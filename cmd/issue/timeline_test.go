@@ -0,0 +1,139 @@
+package issue
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	alice := User{Login: "alice"}
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Type: "assigned", Actor: alice, Assignee: "bob"}, "assigned bob"},
+		{Event{Type: "assigned", Actor: alice, Assignee: "alice"}, "self-assigned this"},
+		{Event{Type: "unassigned", Actor: alice, Assignee: "bob"}, "unassigned bob"},
+		{Event{Type: "unassigned", Actor: alice, Assignee: "alice"}, "removed their assignment"},
+		{Event{Type: "labeled", Actor: alice, Label: "bug"}, "added the bug label"},
+		{Event{Type: "unlabeled", Actor: alice, Label: "bug"}, "removed the bug label"},
+		{Event{Type: "milestoned", Actor: alice, Milestone: "v1"}, "added this to the v1 milestone"},
+		{Event{Type: "demilestoned", Actor: alice, Milestone: "v1"}, "removed this from the v1 milestone"},
+		{Event{Type: "renamed", Actor: alice, From: "Crash", To: `Crash on "start"`}, `changed the title from "Crash" to "Crash on \"start\""`},
+		{Event{Type: "closed", Actor: alice}, "closed this"},
+		{Event{Type: "closed", Actor: alice, Commit: sha}, "closed this in 0123456"},
+		{Event{Type: "reopened", Actor: alice}, "reopened this"},
+		{Event{Type: "merged", Actor: alice}, "merged this"},
+		{Event{Type: "merged", Actor: alice, Commit: sha}, "merged this in 0123456"},
+		{Event{Type: "locked", Actor: alice}, "locked this"},
+		{Event{Type: "unlocked", Actor: alice}, "unlocked this"},
+		{Event{Type: "referenced", Actor: alice, Commit: sha}, "referenced this in commit 0123456"},
+		{Event{Type: "referenced", Actor: alice, Commit: "abc"}, "referenced this in commit abc"},
+		{Event{Type: "cross-referenced", Actor: alice}, "mentioned this"},
+		{Event{Type: "cross-referenced", Actor: alice, Source: &Reference{Repo: "octo/other", Number: 12}}, "mentioned this in octo/other#12"},
+		{Event{Type: "cross-referenced", Actor: alice, Source: &Reference{Repo: "octo/other", Number: 12, Title: "Fix the crash", IsPull: true}}, "mentioned this in octo/other#12 Fix the crash"},
+		// kinds ogi doesn't store yet
+		{Event{Type: "pinned", Actor: alice}, "pinned this"},
+	}
+	described := map[string]bool{}
+	for _, tt := range tests {
+		if got := tt.event.Describe(); got != tt.want {
+			t.Errorf("Describe of %s = %q, want %q", tt.event.Type, got, tt.want)
+		}
+		described[tt.event.Type] = true
+	}
+	for _, kind := range EventTypes {
+		if !described[kind] {
+			t.Errorf("Describe isn't tested with %s events", kind)
+		}
+	}
+}
+
+func TestConversation(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2025, 1, 2, 10, minute, 0, 0, time.UTC) }
+	ptr := func(t time.Time) *time.Time { return &t }
+	is := Issue{
+		Comments: []Comment{
+			{ID: 1, Body: "c1", CreatedAt: at(1)},
+			{ID: 2, Body: "c5", CreatedAt: at(5)},
+			{ID: 3, Body: "c9", CreatedAt: at(9)},
+		},
+		Events: []Event{
+			{Type: "e2", CreatedAt: at(2)},
+			{Type: "e5", CreatedAt: at(5)},
+			{Type: "e8", CreatedAt: at(8)},
+		},
+		PullRequest: &PullRequest{Reviews: []Review{
+			{ID: 1, Body: "r7", SubmittedAt: ptr(at(7))},
+			{ID: 2, Body: "pending"},
+			{ID: 3, Body: "r0", SubmittedAt: ptr(at(0))},
+			{ID: 4, Body: "r5", SubmittedAt: ptr(at(5))},
+		}},
+	}
+	got := []string{}
+	for _, e := range is.Conversation() {
+		switch {
+		case e.Comment != nil:
+			got = append(got, e.Comment.Body)
+		case e.Review != nil:
+			got = append(got, e.Review.Body)
+		case e.Event != nil:
+			got = append(got, e.Event.Type)
+		}
+	}
+	// entries at the same time keep comments, then reviews, then events
+	if want := "r0 c1 e2 c5 r5 e5 r7 e8 c9"; strings.Join(got, " ") != want {
+		t.Errorf("Conversation = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	// the entries point into the issue
+	entries := is.Conversation()
+	if entries[1].Comment != &is.Comments[0] || entries[0].Review != &is.PullRequest.Reviews[2] || entries[2].Event != &is.Events[0] {
+		t.Errorf("Conversation entries don't point to the issue's comments, reviews and events")
+	}
+
+	// an issue has no reviews, an issue without anything loaded no entries
+	if got := len(Issue{Comments: is.Comments}.Conversation()); got != 3 {
+		t.Errorf("Conversation of an issue has %d entries, want 3", got)
+	}
+	if got := (Issue{}).Conversation(); got == nil || len(got) != 0 {
+		t.Errorf("Conversation of an empty issue = %#v, want no entries", got)
+	}
+}
+
+func TestMaintainers(t *testing.T) {
+	is := Issue{
+		Comments: []Comment{
+			{User: User{Login: "owner"}, Association: "OWNER"},
+			{User: User{Login: "member"}, Association: "MEMBER"},
+			{User: User{Login: "collaborator"}, Association: "COLLABORATOR"},
+			{User: User{Login: "contributor"}, Association: "CONTRIBUTOR"},
+			{User: User{Login: "newcomer"}, Association: "FIRST_TIME_CONTRIBUTOR"},
+			{User: User{Login: "someone"}, Association: "NONE"},
+			{User: User{Login: "ghost"}},
+			{Association: "MEMBER"},
+		},
+	}
+	for _, kind := range []string{"assigned", "unassigned", "labeled", "unlabeled", "milestoned", "demilestoned", "merged", "locked", "unlocked"} {
+		is.Events = append(is.Events, Event{Type: kind, Actor: User{Login: kind + "-actor"}})
+	}
+	// anyone can close their own issue, rename it or refer to it
+	for _, kind := range []string{"closed", "reopened", "renamed", "referenced", "cross-referenced"} {
+		is.Events = append(is.Events, Event{Type: kind, Actor: User{Login: kind + "-actor"}})
+	}
+	is.Events = append(is.Events, Event{Type: "labeled"})
+
+	got := slices.Sorted(maps.Keys(is.Maintainers()))
+	want := "[assigned-actor collaborator demilestoned-actor labeled-actor locked-actor member merged-actor milestoned-actor owner unassigned-actor unlabeled-actor unlocked-actor]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Maintainers = %v, want %s", got, want)
+	}
+	if got := (Issue{}).Maintainers(); got == nil || len(got) != 0 {
+		t.Errorf("Maintainers of an empty issue = %v, want none", got)
+	}
+}
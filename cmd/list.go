@@ -4,59 +4,216 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
 )
 
 var state string
 
+// list filter flags
+var listLabels []string
+var listAuthor string
+var listAssignee string
+var listMilestone string
+var listMentions string
+var listNoAssignee bool
+var listCreatedSince string
+var listUpdatedSince string
+
+// list order flags
+var listSort string
+var listAsc bool
+var listDesc bool
+var listLimit int
+var listOffset int
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists issues for the repo.",
+	Long: `List the stored issues of the repo, filtered by state and any of the filter
+flags. Every filter given must match. --label can be repeated to ask for issues
+with all the labels, a comma separated --label matches issues with any of them:
+
+	ogi list --label bug --label ui       bugs in the ui
+	ogi list --label bug,regression       bugs or regressions
+
+Dates are given as 2006-01-02, in local time, or as RFC 3339 times.
+
+The issues are listed by number, lowest first, or by --sort created, updated,
+comments or reactions, highest first. --asc and --desc turn the order around,
+--offset and --limit list a page of them:
+
+	ogi list --sort reactions --limit 10   the 10 issues with most reactions
+	ogi list --sort updated --asc          the issues updated longest ago first`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var issues []issue.Issue
-		var err error
+		q, err := listQuery()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		openStore()
 		// state
 		switch state {
-		case "all":
-			issues, err = db.All()
 		case "closed":
 			println("Closed Issues Only")
-			issues, err = db.AllByState(state)
 		case "open":
 			println("Opened Issues Only")
-			issues, err = db.AllByState(state)
-		default:
-			issues, err = db.All()
 		}
-
+		issues, err := db.Query(q)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(-1)
 		}
-		// raw flag
-		if raw {
-			b, err := json.MarshalIndent(issues, "", "  ")
+		if listMentions != "" {
+			issues, err = filterMentions(issues, strings.TrimPrefix(listMentions, "@"))
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(-1)
 			}
-			fmt.Print(string(b))
-		} else {
-			for _, issue := range issues {
-				fmt.Print(issue.FmtTitle())
-			}
-			fmt.Printf("\n=== (%d) Issues ===\n", len(issues))
+			issues = page(issues, listOffset, listLimit)
 		}
+		printIssues(issues)
 	},
 }
 
+// printIssues prints the titles of the issues and their count, or their raw
+// JSON with the --raw flag.
+func printIssues(issues []issue.Issue) {
+	if raw {
+		b, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		fmt.Print(string(b))
+		return
+	}
+	for _, issue := range issues {
+		fmt.Print(issue.FmtTitle())
+	}
+	fmt.Printf("\n=== (%d) Issues ===\n", len(issues))
+}
+
+// listQuery returns the query selecting the issues asked for by the list
+// flags.
+func listQuery() (storage.Query, error) {
+	q := storage.Query{
+		Author:     strings.TrimPrefix(listAuthor, "@"),
+		Assignee:   strings.TrimPrefix(listAssignee, "@"),
+		Milestone:  listMilestone,
+		NoAssignee: listNoAssignee,
+	}
+	if state == "open" || state == "closed" {
+		q.State = state
+	}
+	if q.NoAssignee && q.Assignee != "" {
+		return q, fmt.Errorf("--assignee and --no-assignee can't be used together")
+	}
+	if listAsc && listDesc {
+		return q, fmt.Errorf("--asc and --desc can't be used together")
+	}
+	if !slices.Contains(storage.Sorts, listSort) {
+		return q, fmt.Errorf("--sort wants one of %s, not %q", strings.Join(storage.Sorts, ", "), listSort)
+	}
+	if listLimit < 0 || listOffset < 0 {
+		return q, fmt.Errorf("--limit and --offset want a number of issues, not %d and %d", listLimit, listOffset)
+	}
+	q.Sort = listSort
+	q.Desc = listSort != "number" && !listAsc || listDesc
+	// --mentions is checked after the query, the page is picked after it
+	if listMentions == "" {
+		q.Offset, q.Limit = listOffset, listLimit
+	}
+	for _, l := range listLabels {
+		set := []string{}
+		for _, name := range strings.Split(l, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				set = append(set, name)
+			}
+		}
+		if len(set) > 0 {
+			q.Labels = append(q.Labels, set)
+		}
+	}
+	var err error
+	if q.CreatedSince, err = parseDate("--created-since", listCreatedSince); err != nil {
+		return q, err
+	}
+	if q.UpdatedSince, err = parseDate("--updated-since", listUpdatedSince); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// parseDate parses the value of a date flag, a day in local time or an RFC
+// 3339 time. An empty value returns the zero time.
+func parseDate(flag string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s wants a date like 2006-01-02 or 2006-01-02T15:04:05Z, not %q", flag, value)
+}
+
+// filterMentions returns the issues that @mention the login in their body or
+// comments. The comments are only loaded for issues whose body doesn't.
+func filterMentions(issues []issue.Issue, login string) ([]issue.Issue, error) {
+	mentioned := []issue.Issue{}
+	for _, i := range issues {
+		if !i.Mentions(login) {
+			comments, err := db.Comments(i.Number)
+			if err != nil {
+				return nil, err
+			}
+			i.Comments = comments
+			if !i.Mentions(login) {
+				continue
+			}
+			i.Comments = nil
+		}
+		mentioned = append(mentioned, i)
+	}
+	return mentioned, nil
+}
+
+// page returns the items from offset up to limit of them, all when limit is
+// zero.
+func page[T any](items []T, offset int, limit int) []T {
+	items = items[min(offset, len(items)):]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
 // init registers the list command with the root command and sets up flags on
 // the list command.
 func init() {
 	RootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVarP(&raw, "raw", "r", false, "Show the raw JSON for these issues")
 	listCmd.Flags().StringVarP(&state, "state", "s", "open", "List issues by their state <all, closed, open>")
+	listCmd.Flags().StringArrayVarP(&listLabels, "label", "l", nil, "List issues with this label, repeat for all of several labels or separate them with commas for any of them")
+	listCmd.Flags().StringVar(&listAuthor, "author", "", "List issues opened by this user")
+	listCmd.Flags().StringVar(&listAssignee, "assignee", "", "List issues assigned to this user")
+	listCmd.Flags().StringVar(&listMilestone, "milestone", "", "List issues of this milestone, by title")
+	listCmd.Flags().StringVar(&listMentions, "mentions", "", "List issues that @mention this user in their body or comments")
+	listCmd.Flags().BoolVar(&listNoAssignee, "no-assignee", false, "List issues not assigned to anybody")
+	listCmd.Flags().StringVar(&listCreatedSince, "created-since", "", "List issues opened on or after this date")
+	listCmd.Flags().StringVar(&listUpdatedSince, "updated-since", "", "List issues updated on or after this date")
+	listCmd.Flags().StringVar(&listSort, "sort", "number", "List issues ordered by <number, created, updated, comments, reactions>")
+	listCmd.Flags().BoolVar(&listAsc, "asc", false, "List the lowest values first, the default for number")
+	listCmd.Flags().BoolVar(&listDesc, "desc", false, "List the highest values first, the default for the other sorts")
+	listCmd.Flags().IntVar(&listLimit, "limit", 0, "List at most this many issues, all when 0")
+	listCmd.Flags().IntVar(&listOffset, "offset", 0, "Skip this many issues before listing")
 }
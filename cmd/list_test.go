@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+)
+
+// listFlags sets the list flags for a test, the others to their defaults.
+type listFlags struct {
+	state, author, assignee, mentions, sort, created, updated string
+	labels                                                    []string
+	noAssignee, asc, desc                                     bool
+	limit, offset                                             int
+}
+
+func (f listFlags) set(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { listFlags{}.apply() })
+	f.apply()
+}
+
+func (f listFlags) apply() {
+	if f.state == "" {
+		f.state = "open"
+	}
+	if f.sort == "" {
+		f.sort = "number"
+	}
+	state, listAuthor, listAssignee, listMentions, listSort = f.state, f.author, f.assignee, f.mentions, f.sort
+	listCreatedSince, listUpdatedSince, listLabels = f.created, f.updated, f.labels
+	listNoAssignee, listAsc, listDesc, listLimit, listOffset = f.noAssignee, f.asc, f.desc, f.limit, f.offset
+}
+
+func TestListQuery(t *testing.T) {
+	day := time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		flags listFlags
+		want  storage.Query
+	}{
+		{"defaults", listFlags{}, storage.Query{State: "open", Sort: "number"}},
+		{"closed", listFlags{state: "closed"}, storage.Query{State: "closed", Sort: "number"}},
+		{"all", listFlags{state: "all"}, storage.Query{Sort: "number"}},
+		{"a label", listFlags{labels: []string{"bug"}},
+			storage.Query{State: "open", Sort: "number", Labels: [][]string{{"bug"}}}},
+		{"labels repeated are all wanted", listFlags{labels: []string{"bug", "ui"}},
+			storage.Query{State: "open", Sort: "number", Labels: [][]string{{"bug"}, {"ui"}}}},
+		{"labels separated by commas are any of them", listFlags{labels: []string{"bug,regression", "ui"}},
+			storage.Query{State: "open", Sort: "number", Labels: [][]string{{"bug", "regression"}, {"ui"}}}},
+		{"blank labels are left out", listFlags{labels: []string{" bug , ,ui ", ",", ""}},
+			storage.Query{State: "open", Sort: "number", Labels: [][]string{{"bug", "ui"}}}},
+		{"people", listFlags{author: "@alice", assignee: "bob"},
+			storage.Query{State: "open", Sort: "number", Author: "alice", Assignee: "bob"}},
+		{"no assignee", listFlags{noAssignee: true}, storage.Query{State: "open", Sort: "number", NoAssignee: true}},
+		{"other sorts are highest first", listFlags{sort: "created"}, storage.Query{State: "open", Sort: "created", Desc: true}},
+		{"--asc", listFlags{sort: "reactions", asc: true}, storage.Query{State: "open", Sort: "reactions"}},
+		{"--desc", listFlags{desc: true}, storage.Query{State: "open", Sort: "number", Desc: true}},
+		{"a page", listFlags{limit: 10, offset: 20}, storage.Query{State: "open", Sort: "number", Limit: 10, Offset: 20}},
+		// --mentions is checked after the query, so it picks the page itself
+		{"a page of mentions", listFlags{limit: 10, offset: 20, mentions: "alice"}, storage.Query{State: "open", Sort: "number"}},
+		{"dates", listFlags{created: "2025-01-02", updated: "2025-01-02T15:04:05Z"},
+			storage.Query{State: "open", Sort: "number", CreatedSince: day, UpdatedSince: at}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flags.set(t)
+			got, err := listQuery()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listQuery = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	failures := []struct {
+		flags listFlags
+		err   string
+	}{
+		{listFlags{assignee: "bob", noAssignee: true}, "--assignee and --no-assignee"},
+		{listFlags{asc: true, desc: true}, "--asc and --desc"},
+		{listFlags{sort: "title"}, `--sort wants one of number, created, updated, comments, reactions, not "title"`},
+		{listFlags{limit: -1}, "--limit and --offset"},
+		{listFlags{offset: -1}, "--limit and --offset"},
+		{listFlags{created: "yesterday"}, `--created-since wants a date like 2006-01-02 or 2006-01-02T15:04:05Z, not "yesterday"`},
+		{listFlags{updated: "2025-13-01"}, "--updated-since"},
+	}
+	for _, tt := range failures {
+		tt.flags.set(t)
+		if _, err := listQuery(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("listQuery with %+v = %v, want an error saying %s", tt.flags, err, tt.err)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"2025-01-02", time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2024-02-29", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"2025-01-02T15:04:05Z", time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"2025-01-02T15:04:05+02:00", time.Date(2025, 1, 2, 13, 4, 5, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseDate("--since", tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"yesterday", "2025-13-01", "2025-02-29", "02/01/2025", "2025-01-02 15:04", "2025-01-02T15:04:05"} {
+		if _, err := parseDate("--since", value); err == nil || !strings.HasPrefix(err.Error(), "--since wants a date") {
+			t.Errorf("parseDate(%q) = %v, want an error naming the flag", value, err)
+		}
+	}
+}
+
+// countingStore counts the issues whose comments are loaded.
+type countingStore struct {
+	storage.Storage
+	loaded []int
+}
+
+func (s *countingStore) Comments(number int) ([]issue.Comment, error) {
+	s.loaded = append(s.loaded, number)
+	return s.Storage.Comments(number)
+}
+
+func TestFilterMentions(t *testing.T) {
+	root, err := bolt.OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	s, err := root.ForRepo("octo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := []issue.Issue{
+		{Number: 1, State: "open", Body: "cc @alice"},
+		{Number: 2, State: "open", Body: "see below", Comments: []issue.Comment{{ID: 1, Body: "no"}, {ID: 2, Body: "@Alice what do you think?"}}},
+		{Number: 3, State: "open", Body: "mail alice@example.com", Comments: []issue.Comment{{ID: 3, Body: "@alice-bob"}}},
+		{Number: 4, State: "open"},
+	}
+	for _, i := range issues {
+		if err := s.Save(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &countingStore{Storage: s}
+	previous := db
+	defer func() { db = previous }()
+	db = counting
+	got, err := filterMentions(stored, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := []int{}
+	for _, i := range got {
+		numbers = append(numbers, i.Number)
+		if len(i.Comments) != 0 {
+			t.Errorf("filterMentions returned #%d with its comments", i.Number)
+		}
+	}
+	if fmt.Sprint(numbers) != "[1 2]" {
+		t.Errorf("filterMentions = %v, want [1 2]", numbers)
+	}
+	// the comments of #1 aren't needed
+	if fmt.Sprint(counting.loaded) != "[2 3 4]" {
+		t.Errorf("filterMentions loaded the comments of %v, want [2 3 4]", counting.loaded)
+	}
+}
@@ -0,0 +1,151 @@
+package markdown
+
+import (
+	"strings"
+)
+
+// keywords are the words highlighted in code, by language.
+var keywords = map[string][]string{
+	"go": {"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map",
+		"package", "range", "return", "select", "struct", "switch", "type", "var",
+		"nil", "true", "false"},
+	"python": {"and", "as", "assert", "async", "await", "break", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if",
+		"import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+		"return", "try", "while", "with", "yield", "None", "True", "False"},
+	"js": {"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "delete", "do", "else", "export", "extends", "finally", "for",
+		"function", "if", "import", "in", "instanceof", "let", "new", "of", "return",
+		"switch", "this", "throw", "try", "typeof", "var", "void", "while", "yield",
+		"null", "undefined", "true", "false", "interface", "type", "enum"},
+	"sh": {"case", "do", "done", "elif", "else", "esac", "export", "fi", "for",
+		"function", "if", "in", "local", "return", "then", "until", "while"},
+	"rust": {"as", "async", "await", "break", "const", "continue", "crate", "else",
+		"enum", "extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod",
+		"move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct",
+		"trait", "type", "unsafe", "use", "where", "while", "true", "false"},
+	"c": {"auto", "break", "case", "char", "class", "const", "continue", "default",
+		"delete", "do", "double", "else", "enum", "extern", "float", "for", "if",
+		"int", "long", "namespace", "new", "return", "short", "signed", "sizeof",
+		"static", "struct", "switch", "template", "typedef", "union", "unsigned",
+		"void", "volatile", "while", "NULL", "nullptr", "true", "false"},
+}
+
+// aliases are the other names of the languages in keywords.
+var aliases = map[string]string{
+	"golang": "go", "py": "python", "javascript": "js", "ts": "js",
+	"typescript": "js", "jsx": "js", "tsx": "js", "json": "js", "bash": "sh",
+	"shell": "sh", "zsh": "sh", "console": "sh", "rs": "rust", "cpp": "c",
+	"c++": "c", "h": "c", "java": "c", "cs": "c",
+}
+
+// lineComments are the markers of comments running to the end of a line.
+var lineComments = map[string][]string{
+	"go": {"//"}, "js": {"//"}, "rust": {"//"}, "c": {"//"},
+	"python": {"#"}, "sh": {"#"},
+}
+
+// codeBlock renders the lines of a code block in the language lang, indented
+// by two spaces. Lines aren't wrapped, to keep the code as it was written.
+func codeBlock(lines []string, lang string) []string {
+	lang = strings.ToLower(lang)
+	if l, ok := aliases[lang]; ok {
+		lang = l
+	}
+	out := []string{}
+	for _, line := range lines {
+		var drawn string
+		switch {
+		case lang == "diff" || lang == "patch":
+			drawn = diffLine(line)
+		case keywords[lang] != nil:
+			drawn = draw(highlight(line, lang))
+		default:
+			drawn = paint(line, code)
+		}
+		out = append(out, "  "+drawn)
+	}
+	return out
+}
+
+// diffLine colours a line of a diff by what it does.
+func diffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+		return paint(line, bold)
+	case strings.HasPrefix(line, "+"):
+		return paint(line, added)
+	case strings.HasPrefix(line, "-"):
+		return paint(line, removed)
+	case strings.HasPrefix(line, "@@"):
+		return paint(line, faint)
+	}
+	return line
+}
+
+// highlight splits a line of code in a language into keywords, strings,
+// numbers, comments and the rest.
+func highlight(line string, lang string) []span {
+	words := map[string]bool{}
+	for _, w := range keywords[lang] {
+		words[w] = true
+	}
+	spans := []span{}
+	plain := 0
+	flush := func(i int) {
+		if i > plain {
+			spans = append(spans, span{line[plain:i], 0})
+		}
+	}
+	for i := 0; i < len(line); {
+		c := line[i]
+		for _, marker := range lineComments[lang] {
+			if strings.HasPrefix(line[i:], marker) {
+				flush(i)
+				return append(spans, span{line[i:], faint})
+			}
+		}
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			flush(i)
+			spans = append(spans, span{line[i:end], str})
+			i, plain = end, end
+		case isWordByte(c):
+			end := i
+			for end < len(line) && isWordByte(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			st := style(0)
+			if words[word] {
+				st = keyword
+			} else if c >= '0' && c <= '9' {
+				st = number
+			}
+			if st != 0 {
+				flush(i)
+				spans = append(spans, span{word, st})
+				plain = end
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	flush(len(line))
+	return spans
+}
+
+// isWordByte reports whether c can be part of an identifier or number.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,375 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// style is a set of text attributes, drawn with ANSI escape sequences.
+type style int
+
+const (
+	bold style = 1 << iota
+	italic
+	underline
+	strike
+	faint
+	code
+	link
+	heading
+	keyword
+	str
+	number
+	added
+	removed
+)
+
+// sgr returns the escape sequence switching on the attributes of a style.
+func (st style) sgr() string {
+	codes := []string{}
+	add := func(s style, c string) {
+		if st&s != 0 {
+			codes = append(codes, c)
+		}
+	}
+	add(bold, "1")
+	add(faint, "2")
+	add(italic, "3")
+	add(underline, "4")
+	add(strike, "9")
+	add(code, "33")
+	add(link, "4;34")
+	add(heading, "1;36")
+	add(keyword, "35")
+	add(str, "32")
+	add(number, "33")
+	add(added, "32")
+	add(removed, "31")
+	if len(codes) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// paint returns the text drawn in a style.
+func paint(text string, st style) string {
+	if st == 0 || text == "" {
+		return text
+	}
+	return st.sgr() + text + "\x1b[0m"
+}
+
+// span is a piece of text in one style.
+type span struct {
+	text  string
+	style style
+}
+
+// textWidth returns the number of columns the spans take.
+func textWidth(spans []span) int {
+	n := 0
+	for _, s := range spans {
+		n += utf8.RuneCountInString(s.text)
+	}
+	return n
+}
+
+// draw returns the spans drawn in their styles.
+func draw(spans []span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		b.WriteString(paint(s.text, s.style))
+	}
+	return b.String()
+}
+
+// inline parses the emphasis, code spans, links and images of a line of
+// Markdown into spans, on top of the style st.
+func inline(s string, st style) []span {
+	spans := []span{}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, span{text.String(), st})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && unicode.IsPunct(rune(s[i+1])):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := run(s, i, '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				flush()
+				content := s[i+n : i+n+end]
+				if len(content) > 2 && content[0] == ' ' && content[len(content)-1] == ' ' {
+					content = content[1 : len(content)-1]
+				}
+				spans = append(spans, span{content, st | code})
+				i += n + end + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if label, url, n, ok := parseLink(s[i+1:]); ok {
+				flush()
+				spans = append(spans, span{"[image: " + label + "]", st | link})
+				spans = append(spans, span{" (" + url + ")", st | faint})
+				i += 1 + n
+				continue
+			}
+		case c == '[':
+			if label, url, n, ok := parseLink(s[i:]); ok {
+				flush()
+				spans = append(spans, inline(label, st|link)...)
+				if url != label && url != "" && !strings.HasPrefix(url, "#") {
+					spans = append(spans, span{" (" + url + ")", st | faint})
+				}
+				i += n
+				continue
+			}
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				url := s[i+1 : i+end]
+				if (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && !strings.ContainsAny(url, " <") {
+					flush()
+					spans = append(spans, span{url, st | link})
+					i += end + 1
+					continue
+				}
+			}
+		case c == '~' && strings.HasPrefix(s[i:], "~~"):
+			if end := closing(s, i+2, "~~"); end >= 0 {
+				flush()
+				spans = append(spans, inline(s[i+2:end], st|strike)...)
+				i = end + 2
+				continue
+			}
+		case c == '*' || c == '_':
+			n := min(run(s, i, c), 3)
+			delim := s[i : i+n]
+			if opens(s, i, n) {
+				if end := closing(s, i+n, delim); end >= 0 {
+					flush()
+					inner := st
+					if n >= 2 {
+						inner |= bold
+					}
+					if n != 2 {
+						inner |= italic
+					}
+					spans = append(spans, inline(s[i+n:end], inner)...)
+					i = end + n
+					continue
+				}
+			}
+			text.WriteString(delim)
+			i += n
+			continue
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return spans
+}
+
+// run returns how many times c repeats from s[i].
+func run(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// opens reports whether the n * or _ at s[i] can open emphasis: they are
+// followed by text, and _ isn't inside a word like snake_case.
+func opens(s string, i int, n int) bool {
+	if i+n >= len(s) || s[i+n] == ' ' {
+		return false
+	}
+	if s[i] == '_' && i > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:i])
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return true
+}
+
+// closing returns the index of the delimiter closing emphasis opened before
+// from, or -1. It must follow text, and a _ must end a word.
+func closing(s string, from int, delim string) int {
+	for i := from; i+len(delim) <= len(s); i++ {
+		if s[i] == '`' {
+			// code spans can't hold the end of emphasis
+			n := run(s, i, '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				i += n + end + n - 1
+			}
+			continue
+		}
+		if !strings.HasPrefix(s[i:], delim) || i == from || s[i-1] == ' ' {
+			continue
+		}
+		after := i + len(delim)
+		if after < len(s) && s[after] == delim[0] {
+			// part of a longer run, like the end of ***both***
+			continue
+		}
+		if delim[0] == '_' && after < len(s) {
+			r, _ := utf8.DecodeRuneInString(s[after:])
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// parseLink parses a [label](url) at the start of s, returning its length.
+func parseLink(s string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			target := strings.TrimSpace(s[i+2 : i+2+end])
+			// drop a "title" after the url
+			if url, _, ok := strings.Cut(target, " "); ok {
+				target = url
+			}
+			return s[1:i], strings.Trim(target, "<>"), i + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// wrap lays out spans in lines at most width columns wide, breaking them at
+// spaces. Words longer than a line are split.
+func wrap(spans []span, width int) []string {
+	width = max(width, 10)
+	type word struct {
+		pieces []span
+		space  bool
+	}
+	words := []word{}
+	current := word{}
+	space := false
+	for _, s := range spans {
+		for _, part := range strings.SplitAfter(s.text, " ") {
+			text := strings.TrimRight(part, " ")
+			if text != "" {
+				current.pieces = append(current.pieces, span{text, s.style})
+			}
+			if len(text) < len(part) {
+				if len(current.pieces) > 0 {
+					current.space = space
+					words = append(words, current)
+					current = word{}
+				}
+				space = true
+			}
+		}
+	}
+	if len(current.pieces) > 0 {
+		current.space = space
+		words = append(words, current)
+	}
+
+	lines := []string{}
+	var line strings.Builder
+	used := 0
+	last := style(0)
+	for _, w := range words {
+		n := 0
+		for _, p := range w.pieces {
+			n += utf8.RuneCountInString(p.text)
+		}
+		if used > 0 && used+1+n > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			used = 0
+		}
+		if used > 0 && w.space {
+			// keep underlines and strikes going between words drawn alike
+			if st := w.pieces[0].style; st == last && st&(underline|strike|link) != 0 {
+				line.WriteString(paint(" ", st))
+			} else {
+				line.WriteByte(' ')
+			}
+			used++
+		}
+		for _, p := range w.pieces {
+			text := []rune(p.text)
+			for used+len(text) > width && used < width {
+				// split a word too long for a line
+				cut := width - used
+				line.WriteString(paint(string(text[:cut]), p.style))
+				lines = append(lines, line.String())
+				line.Reset()
+				used = 0
+				text = text[cut:]
+			}
+			line.WriteString(paint(string(text), p.style))
+			used += len(text)
+			last = p.style
+		}
+	}
+	if used > 0 || len(lines) == 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// truncate cuts spans to at most n columns, ending them with an ellipsis.
+func truncate(spans []span, n int) []span {
+	if textWidth(spans) <= n {
+		return spans
+	}
+	cut := []span{}
+	left := n - 1
+	for _, s := range spans {
+		text := []rune(s.text)
+		if len(text) >= left {
+			cut = append(cut, span{string(text[:left]) + "…", s.style})
+			return cut
+		}
+		cut = append(cut, s)
+		left -= len(text)
+	}
+	return cut
+}
+
+// Bold returns text drawn in bold, for the lines printed around rendered
+// Markdown.
+func Bold(text string) string {
+	return paint(text, bold)
+}
+
+// Faint returns text drawn faint, for the lines printed around rendered
+// Markdown.
+func Faint(text string) string {
+	return paint(text, faint)
+}
@@ -0,0 +1,395 @@
+// Package markdown renders the GitHub flavored Markdown of issues and
+// comments for a terminal: headings, emphasis, code with simple syntax
+// highlighting, block quotes, lists, task lists and tables, wrapped to the
+// width of the terminal and styled with ANSI escape sequences.
+package markdown
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	fencePattern     = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([^`\\s]*)")
+	headingPattern   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	rulePattern      = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	quotePattern     = regexp.MustCompile(`^ {0,3}> ?`)
+	itemPattern      = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])( +|$)(.*)$`)
+	taskPattern      = regexp.MustCompile(`^\[([ xX])\]\s+`)
+	separatorPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	setextPattern    = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	commentPattern   = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// bullets are the markers of unordered list items, by nesting depth.
+var bullets = []string{"•", "◦", "▪"}
+
+// renderer renders the blocks of a document.
+type renderer struct {
+	// depth is the nesting depth of the list being rendered.
+	depth int
+	// tight is set while rendering the item of a list without blank lines,
+	// its blocks aren't separated by blank lines either.
+	tight bool
+}
+
+// Render returns the Markdown src rendered for a terminal width columns
+// wide. HTML comments, which GitHub hides, are left out.
+func Render(src string, width int) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = commentPattern.ReplaceAllString(src, "")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	r := &renderer{}
+	return strings.Join(r.blocks(strings.Split(src, "\n"), width), "\n")
+}
+
+// blocks renders lines of Markdown as lines of text, with a blank line
+// between blocks. Quotes and lists nested deeper than the width render their
+// content one column wide.
+func (r *renderer) blocks(lines []string, width int) []string {
+	width = max(width, 1)
+	out := []string{}
+	block := func(rendered []string) {
+		if len(out) > 0 && !r.tight {
+			out = append(out, "")
+		}
+		out = append(out, rendered...)
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			end := i + 1
+			for end < len(lines) && !isFenceEnd(lines[end], m[1]) {
+				end++
+			}
+			block(codeBlock(lines[i+1:min(end, len(lines))], m[2]))
+			i = end + 1
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			block(headingLines(m[2], len(m[1]), width))
+			i++
+			continue
+		}
+		if rulePattern.MatchString(line) {
+			block([]string{paint(strings.Repeat("─", width), faint)})
+			i++
+			continue
+		}
+		if quotePattern.MatchString(line) {
+			end := i
+			quoted := []string{}
+			for end < len(lines) && quotePattern.MatchString(lines[end]) {
+				quoted = append(quoted, quotePattern.ReplaceAllString(lines[end], ""))
+				end++
+			}
+			inner := r.blocks(quoted, width-2)
+			for n, l := range inner {
+				inner[n] = paint("│", faint) + " " + l
+			}
+			block(inner)
+			i = end
+			continue
+		}
+		if i+1 < len(lines) && strings.Contains(line, "|") && separatorPattern.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "-") {
+			end := i + 2
+			for end < len(lines) && strings.Contains(lines[end], "|") && strings.TrimSpace(lines[end]) != "" {
+				end++
+			}
+			block(table(line, lines[i+1], lines[i+2:end], width))
+			i = end
+			continue
+		}
+		if itemPattern.MatchString(line) {
+			rendered, end := r.list(lines, i, width)
+			block(rendered)
+			i = end
+			continue
+		}
+		if strings.HasPrefix(line, "    ") {
+			end := i
+			for end < len(lines) && (strings.HasPrefix(lines[end], "    ") || strings.TrimSpace(lines[end]) == "") {
+				end++
+			}
+			code := []string{}
+			for _, l := range lines[i:end] {
+				code = append(code, strings.TrimPrefix(l, "    "))
+			}
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			block(codeBlock(code, ""))
+			i = end
+			continue
+		}
+
+		// a paragraph, its lines are kept as GitHub keeps them in issues
+		end := i
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" && (end == i || !startsBlock(lines[end])) {
+			if end > i && setextPattern.MatchString(lines[end]) {
+				break
+			}
+			end++
+		}
+		if end < len(lines) && end > i && setextPattern.MatchString(lines[end]) {
+			level := 2
+			if strings.Contains(lines[end], "=") {
+				level = 1
+			}
+			block(headingLines(strings.Join(trimAll(lines[i:end]), " "), level, width))
+			i = end + 1
+			continue
+		}
+		paragraph := []string{}
+		for _, l := range lines[i:end] {
+			paragraph = append(paragraph, wrap(inline(strings.TrimSpace(l), 0), width)...)
+		}
+		block(paragraph)
+		i = end
+	}
+	return out
+}
+
+// startsBlock reports whether a line starts a block other than a paragraph.
+func startsBlock(line string) bool {
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || quotePattern.MatchString(line) ||
+		itemPattern.MatchString(line)
+}
+
+// isFenceEnd reports whether a line closes a code fence opened with fence.
+func isFenceEnd(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// headingLines renders a heading, underlining the top level ones.
+func headingLines(text string, level int, width int) []string {
+	st := heading
+	if level == 1 {
+		st |= underline
+	}
+	return wrap(inline(text, st), width)
+}
+
+// list renders the list starting at lines[start], returning its lines and
+// the index of the line after it.
+func (r *renderer) list(lines []string, start int, width int) ([]string, int) {
+	out := []string{}
+	first := itemPattern.FindStringSubmatch(lines[start])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+	counter, _ := strconv.Atoi(strings.TrimRight(first[2], ".)"))
+	i := start
+	for i < len(lines) {
+		m := itemPattern.FindStringSubmatch(lines[i])
+		if m == nil || (m[2][0] >= '0' && m[2][0] <= '9') != ordered {
+			break
+		}
+		contentIndent := len(m[1]) + len(m[2]) + min(max(len(m[3]), 1), 4)
+		content := []string{m[4]}
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				next := i + 1
+				for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+					next++
+				}
+				if next == len(lines) || indent(lines[next]) < contentIndent {
+					break
+				}
+				content = append(content, "")
+				i++
+				continue
+			}
+			if indent(line) >= contentIndent {
+				content = append(content, line[contentIndent:])
+				i++
+				continue
+			}
+			if startsBlock(line) {
+				break
+			}
+			// a lazy continuation of the item's paragraph
+			content = append(content, strings.TrimSpace(line))
+			i++
+		}
+
+		marker := bullets[min(r.depth, len(bullets)-1)]
+		if ordered {
+			marker = strconv.Itoa(counter) + "."
+			counter++
+		}
+		if t := taskPattern.FindStringSubmatch(content[0]); t != nil {
+			marker = "☐"
+			if t[1] != " " {
+				marker = paint("☑", added)
+			}
+			content[0] = content[0][len(t[0]):]
+		}
+		markerWidth := utf8.RuneCountInString(stripStyle(marker)) + 1
+		tight := r.tight
+		r.tight = !slices.Contains(content, "")
+		r.depth++
+		rendered := r.blocks(content, width-markerWidth)
+		r.depth--
+		r.tight = tight
+		for n, l := range rendered {
+			if n == 0 {
+				out = append(out, marker+" "+l)
+			} else if l == "" {
+				out = append(out, "")
+			} else {
+				out = append(out, strings.Repeat(" ", markerWidth)+l)
+			}
+		}
+		if len(rendered) == 0 {
+			out = append(out, marker)
+		}
+		// skip the blank lines between items of the same list
+		next := i
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+		if next == len(lines) || !itemPattern.MatchString(lines[next]) || indent(lines[next]) > indent(lines[start]) {
+			break
+		}
+		i = next
+	}
+	return out, i
+}
+
+// table renders a table from its header, separator and rows. The widest
+// columns are cut when it doesn't fit the width.
+func table(header string, separator string, rows []string, width int) []string {
+	aligns := []string{}
+	for _, c := range cells(separator) {
+		switch {
+		case strings.HasPrefix(c, ":") && strings.HasSuffix(c, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(c, ":"):
+			aligns = append(aligns, "right")
+		default:
+			aligns = append(aligns, "left")
+		}
+	}
+	grid := [][][]span{}
+	for n, row := range append([]string{header}, rows...) {
+		st := style(0)
+		if n == 0 {
+			st = bold
+		}
+		line := [][]span{}
+		for _, c := range cells(row) {
+			line = append(line, inline(c, st))
+		}
+		grid = append(grid, line)
+	}
+	columns := len(aligns)
+	widths := make([]int, columns)
+	for _, row := range grid {
+		for c := 0; c < columns && c < len(row); c++ {
+			widths[c] = max(widths[c], textWidth(row[c]))
+		}
+	}
+	for {
+		total := 3 * (columns - 1)
+		widest := 0
+		for c, w := range widths {
+			total += w
+			if w > widths[widest] {
+				widest = c
+			}
+		}
+		if total <= width || widths[widest] <= 3 {
+			break
+		}
+		widths[widest]--
+	}
+
+	out := []string{}
+	bar := paint(" │ ", faint)
+	for n, row := range grid {
+		drawn := []string{}
+		for c := 0; c < columns; c++ {
+			cell := []span{}
+			if c < len(row) {
+				cell = truncate(row[c], widths[c])
+			}
+			pad := widths[c] - textWidth(cell)
+			switch aligns[c] {
+			case "right":
+				drawn = append(drawn, strings.Repeat(" ", pad)+draw(cell))
+			case "center":
+				drawn = append(drawn, strings.Repeat(" ", pad/2)+draw(cell)+strings.Repeat(" ", pad-pad/2))
+			default:
+				drawn = append(drawn, draw(cell)+strings.Repeat(" ", pad))
+			}
+		}
+		out = append(out, strings.TrimRight(strings.Join(drawn, bar), " "))
+		if n == 0 {
+			rules := []string{}
+			for _, w := range widths {
+				rules = append(rules, strings.Repeat("─", w))
+			}
+			out = append(out, paint(strings.Join(rules, "─┼─"), faint))
+		}
+	}
+	return out
+}
+
+// cells splits a table row on the | that aren't escaped or in code.
+func cells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, "\\|") {
+		row = row[:len(row)-1]
+	}
+	out := []string{}
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+			continue
+		case row[i] == '`':
+			inCode = !inCode
+		case row[i] == '|' && !inCode:
+			out = append(out, strings.TrimSpace(cell.String()))
+			cell.Reset()
+			continue
+		}
+		cell.WriteByte(row[i])
+	}
+	return append(out, strings.TrimSpace(cell.String()))
+}
+
+// indent returns the number of spaces a line starts with.
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimAll trims the spaces around each line.
+func trimAll(lines []string) []string {
+	trimmed := []string{}
+	for _, l := range lines {
+		trimmed = append(trimmed, strings.TrimSpace(l))
+	}
+	return trimmed
+}
+
+// stripStyle removes the escape sequences of styled text.
+func stripStyle(s string) string {
+	return stylePattern.ReplaceAllString(s, "")
+}
+
+var stylePattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
@@ -0,0 +1,142 @@
+package markdown
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestRender")
+
+// TestRender renders testdata/name.md at a width and compares the output,
+// escape sequences included, with testdata/name.width.golden. Run the tests
+// with -update to rewrite the golden files after a change of the rendering,
+// and check the diff.
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+	}{
+		{"headings", 60},
+		{"lists", 60},
+		{"code", 60},
+		{"links", 60},
+		{"emphasis", 60},
+		{"wrap", 40},
+		{"wrap", 24},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.name, tt.width), func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("testdata", tt.name+".md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Render(string(src), tt.width) + "\n"
+			golden := filepath.Join("testdata", fmt.Sprintf("%s.%d.golden", tt.name, tt.width))
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("Render(%s.md, %d) doesn't match %s, without styles it is:\n%s\nwant:\n%s",
+					tt.name, tt.width, golden, stripStyle(got), stripStyle(string(want)))
+			}
+		})
+	}
+}
+
+// TestRenderWidth checks no rendered line is wider than the width, but for
+// words too long to fit any line. Code blocks are kept as they are, so
+// code.md isn't checked.
+func TestRenderWidth(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if filepath.Base(file) == "code.md" {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, width := range []int{20, 40, 80} {
+			for _, line := range strings.Split(Render(string(src), width), "\n") {
+				plain := stripStyle(line)
+				if utf8.RuneCountInString(plain) > width && !strings.Contains(plain, "Averyvery") {
+					t.Errorf("%s at width %d renders a line %d wide: %q", file, width, utf8.RuneCountInString(plain), plain)
+				}
+			}
+		}
+	}
+}
+
+func TestBoldFaint(t *testing.T) {
+	if got := Bold("alice"); stripStyle(got) != "alice" || got == "alice" {
+		t.Errorf("Bold(alice) = %q, want alice styled", got)
+	}
+	if got := Faint("(author)"); stripStyle(got) != "(author)" || got == "(author)" {
+		t.Errorf("Faint((author)) = %q, want (author) styled", got)
+	}
+}
+
+// TestRenderNarrow checks Markdown renders without panicking when the width
+// is used up, by the terminal or by nested quotes and lists.
+func TestRenderNarrow(t *testing.T) {
+	all := ""
+	files, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all += string(src) + "\n\n"
+	}
+	list := ""
+	for n := 0; n < 50; n++ {
+		list += strings.Repeat("  ", n) + "- item\n"
+	}
+	tests := []struct {
+		src   string
+		width int
+	}{
+		{"> > > ***", 4},
+		{strings.Repeat("> ", 41) + "***", 80},
+		{strings.Repeat("> ", 41) + "a quote | of a table\n" + strings.Repeat("> ", 41) + "--- | ---\n" + strings.Repeat("> ", 41) + "a | b", 80},
+		{strings.Repeat("> ", 41) + "# a heading\n" + strings.Repeat("> ", 41) + "a paragraph", 80},
+		{list + strings.Repeat("  ", 50) + "***", 80},
+		{"***", 0},
+		{"***", -5},
+		{all, 0},
+		{all, 1},
+		{all, 3},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("Render(%.40q, %d) panicked: %v", tt.src, tt.width, err)
+				}
+			}()
+			if got := Render(tt.src, tt.width); strings.TrimSpace(stripStyle(got)) == "" {
+				t.Errorf("Render(%.40q, %d) rendered nothing", tt.src, tt.width)
+			}
+		}()
+	}
+	if got := stripStyle(Render("***", 0)); got != "─" {
+		t.Errorf("Render(***, 0) = %q, want a rule one column wide", got)
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// concurrency holds the --concurrency flag shared by fetch and update.
+var concurrency int
+
+const (
+	// maxRetries is how many times a request failing with a transient error
+	// is retried before giving up.
+	maxRetries = 5
+	// minRemaining is the number of requests kept in reserve; workers pause
+	// until the rate limit resets once fewer requests than this are left.
+	minRemaining = 10
+)
+
+// The waits between retries, variables so tests can shorten them.
+var (
+	// serverBackoff is the wait before retrying a server error, doubled
+	// with every retry.
+	serverBackoff = time.Second
+	// abuseBackoff is the wait after a secondary rate limit response that
+	// carries no Retry-After header.
+	abuseBackoff = time.Minute
+	// minRateLimitWait is the shortest wait after the rate limit was
+	// exceeded, when its reset time has already passed.
+	minRateLimitWait = time.Second
+)
+
+// fetcher wraps the GitHub client with a bounded pool of workers. Requests
+// made through it pause while the rate limit is exhausted, back off when the
+// secondary rate limit is hit and retry transient server errors.
+type fetcher struct {
+	client  *github.Client
+	workers int
+
+	// onWait is called, when set, each time requests are paused, and with a
+	// zero time and empty reason once they resume.
+	onWait func(until time.Time, reason string)
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// issueError records why fetching a single issue failed.
+type issueError struct {
+	Number int
+	Err    error
+}
+
+func (e issueError) Error() string {
+	return fmt.Sprintf("#%d: %s", e.Number, e.Err)
+}
+
+// newFetcher returns a fetcher running at most workers requests at a time.
+func newFetcher(client *github.Client, workers int) *fetcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &fetcher{client: client, workers: workers}
+}
+
+// Run calls block for every index below length on the pool's workers and
+// waits for all of them. Errors don't stop the other jobs, they are returned
+// ordered by index once every job has finished. Jobs not yet started when
+// the context is cancelled are skipped.
+func (f *fetcher) Run(ctx context.Context, length int, block func(index int) error) []error {
+	jobs := make(chan int)
+	errs := make([]error, length)
+
+	var w sync.WaitGroup
+	for n := 0; n < f.workers && n < length; n++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for index := range jobs {
+				errs[index] = block(index)
+			}
+		}()
+	}
+	for i := 0; i < length; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	w.Wait()
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// do performs one API request, waiting first if the pool is paused. It pauses
+// the pool when the rate limit runs low or a secondary rate limit is hit, and
+// retries rate limited requests and 5xx errors with an exponential backoff,
+// at most maxRetries times.
+func (f *fetcher) do(ctx context.Context, call func() (*github.Response, error)) error {
+	backoff := serverBackoff
+	for attempt := 0; ; attempt++ {
+		if err := f.wait(ctx); err != nil {
+			return err
+		}
+		resp, err := call()
+		if resp != nil && resp.Rate.Limit > 0 && resp.Rate.Remaining < minRemaining {
+			f.pause(resp.Rate.Reset.Time, "rate limit almost used up")
+		}
+		if err == nil {
+			return nil
+		}
+
+		var rateErr *github.RateLimitError
+		var abuseErr *github.AbuseRateLimitError
+		switch {
+		case errors.As(err, &rateErr):
+			until := rateErr.Rate.Reset.Time
+			if time.Until(until) < minRateLimitWait {
+				until = time.Now().Add(minRateLimitWait)
+			}
+			f.pause(until, "rate limit exceeded")
+		case errors.As(err, &abuseErr):
+			wait := abuseBackoff << attempt
+			if abuseErr.RetryAfter != nil {
+				wait = *abuseErr.RetryAfter
+			}
+			f.pause(time.Now().Add(wait), "secondary rate limit")
+		case resp != nil && retryAfter(resp) > 0:
+			f.pause(time.Now().Add(retryAfter(resp)), "secondary rate limit")
+		case resp != nil && resp.StatusCode >= http.StatusInternalServerError:
+			if attempt >= maxRetries {
+				return err
+			}
+			f.pause(time.Now().Add(backoff), fmt.Sprintf("server error %d", resp.StatusCode))
+			backoff *= 2
+		default:
+			return err
+		}
+		if attempt >= maxRetries {
+			return err
+		}
+	}
+}
+
+// retryAfter returns the wait asked for by a 403 or 429 response's
+// Retry-After header, which GitHub sends with secondary rate limits.
+func retryAfter(resp *github.Response) time.Duration {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// pause stops every worker from sending requests until the given time, a
+// time already passed is ignored.
+func (f *fetcher) pause(until time.Time, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if until.After(f.pausedUntil) && until.After(time.Now()) {
+		f.pausedUntil = until
+		if f.onWait != nil {
+			f.onWait(until, reason)
+		}
+	}
+}
+
+// wait blocks until the pool is no longer paused or the context is done.
+func (f *fetcher) wait(ctx context.Context) error {
+	for {
+		f.mu.Lock()
+		until := f.pausedUntil
+		f.mu.Unlock()
+		d := time.Until(until)
+		if d <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			f.resume(until)
+		}
+	}
+}
+
+// resume reports the end of the pause lasting until the given time, unless
+// the pause has been extended since.
+func (f *fetcher) resume(until time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pausedUntil.Equal(until) && f.onWait != nil {
+		f.onWait(time.Time{}, "")
+		f.pausedUntil = time.Time{}
+	}
+}
+
+// printIssueErrors prints the summary of the issues that could not be fetched.
+func printIssueErrors(errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Printf("\nFailed to fetch %d issues:\n", len(errs))
+	for _, err := range errs {
+		fmt.Printf("\t%s\n", err)
+	}
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// shortWaits shortens the waits between retries for the test.
+func shortWaits(t *testing.T) {
+	server, abuse, rate := serverBackoff, abuseBackoff, minRateLimitWait
+	t.Cleanup(func() { serverBackoff, abuseBackoff, minRateLimitWait = server, abuse, rate })
+	serverBackoff, abuseBackoff, minRateLimitWait = time.Millisecond, 10*time.Millisecond, 10*time.Millisecond
+}
+
+// waits records the pauses a fetcher reports, a resume as an empty reason.
+type waits struct {
+	mu      sync.Mutex
+	reasons []string
+	until   []time.Time
+}
+
+func (w *waits) onWait(until time.Time, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reasons = append(w.reasons, reason)
+	w.until = append(w.until, until)
+}
+
+// get returns a fetcher calling a server answering each request with the
+// response of respond for the request's number, counted from 0, and the
+// function making one request through the fetcher.
+func get(t *testing.T, respond func(n int, w http.ResponseWriter)) (*fetcher, *waits, func() error, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n := requests
+		requests++
+		mu.Unlock()
+		respond(n, w)
+	}))
+	t.Cleanup(srv.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	f := newFetcher(client, 1)
+	w := &waits{}
+	f.onWait = w.onWait
+	do := func() error {
+		return f.do(context.Background(), func() (*github.Response, error) {
+			req, err := client.NewRequest("GET", "repos/octo/hello", nil)
+			if err != nil {
+				return nil, err
+			}
+			return client.Do(context.Background(), req, nil)
+		})
+	}
+	return f, w, do, &requests
+}
+
+// rateLimited answers that the rate limit is used up until reset.
+func rateLimited(w http.ResponseWriter, reset time.Time) {
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Remaining", "0")
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprint(w, `{"message": "API rate limit exceeded for 127.0.0.1."}`)
+}
+
+func TestDoServerErrors(t *testing.T) {
+	shortWaits(t)
+	_, w, do, requests := get(t, func(n int, w http.ResponseWriter) {
+		if n < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	})
+	if err := do(); err != nil {
+		t.Fatalf("do after two server errors: %s", err)
+	}
+	if *requests != 3 {
+		t.Errorf("do sent %d requests, want 3", *requests)
+	}
+	if fmt.Sprint(w.reasons) != "[server error 502  server error 502 ]" {
+		t.Errorf("do paused for %q, want two server errors and their resumes", w.reasons)
+	}
+	// the backoff doubles
+	if first, second := w.until[0], w.until[2]; second.Sub(first) < serverBackoff {
+		t.Errorf("the second backoff ends %s after the first, want at least %s", second.Sub(first), serverBackoff)
+	}
+
+	_, _, do, requests = get(t, func(n int, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	var errResp *github.ErrorResponse
+	if err := do(); !errors.As(err, &errResp) || errResp.Response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("do of a failing server = %v, want its error", err)
+	}
+	if *requests != maxRetries+1 {
+		t.Errorf("do of a failing server sent %d requests, want %d", *requests, maxRetries+1)
+	}
+
+	// client errors aren't retried
+	_, _, do, requests = get(t, func(n int, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if err := do(); err == nil || *requests != 1 {
+		t.Errorf("do of a missing repo = %v after %d requests, want an error after 1", err, *requests)
+	}
+}
+
+func TestDoRateLimit(t *testing.T) {
+	shortWaits(t)
+	// the reset has passed, so the shortest wait is used
+	_, w, do, requests := get(t, func(n int, w http.ResponseWriter) {
+		if n == 0 {
+			rateLimited(w, time.Now().Add(-time.Minute))
+			return
+		}
+		fmt.Fprint(w, "{}")
+	})
+	if err := do(); err != nil || *requests != 2 {
+		t.Errorf("do after the rate limit was exceeded = %v after %d requests, want success after 2", err, *requests)
+	}
+	if fmt.Sprint(w.reasons) != "[rate limit exceeded ]" {
+		t.Errorf("do paused for %q, want the rate limit and its resume", w.reasons)
+	}
+
+	// a rate limit that never resets gives up like other errors
+	_, _, do, requests = get(t, func(n int, w http.ResponseWriter) {
+		rateLimited(w, time.Now().Add(-time.Minute))
+	})
+	var rateErr *github.RateLimitError
+	if err := do(); !errors.As(err, &rateErr) {
+		t.Errorf("do while rate limited = %v, want a rate limit error", err)
+	}
+	if *requests != maxRetries+1 {
+		t.Errorf("do while rate limited sent %d requests, want %d", *requests, maxRetries+1)
+	}
+}
+
+func TestDoSecondaryRateLimit(t *testing.T) {
+	shortWaits(t)
+	// a 403 documented as a secondary rate limit, without Retry-After
+	_, w, do, requests := get(t, func(n int, w http.ResponseWriter) {
+		if n == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	})
+	started := time.Now()
+	if err := do(); err != nil || *requests != 2 {
+		t.Errorf("do after a secondary rate limit = %v after %d requests, want success after 2", err, *requests)
+	}
+	if time.Since(started) < abuseBackoff {
+		t.Errorf("do retried after %s, want at least %s", time.Since(started), abuseBackoff)
+	}
+	if fmt.Sprint(w.reasons) != "[secondary rate limit ]" {
+		t.Errorf("do paused for %q, want the secondary rate limit and its resume", w.reasons)
+	}
+
+	// a 429 with Retry-After
+	_, w, do, requests = get(t, func(n int, w http.ResponseWriter) {
+		if n == 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	})
+	started = time.Now()
+	if err := do(); err != nil || *requests != 2 {
+		t.Errorf("do after Retry-After = %v after %d requests, want success after 2", err, *requests)
+	}
+	if time.Since(started) < time.Second {
+		t.Errorf("do retried after %s, want at least the second of Retry-After", time.Since(started))
+	}
+	if fmt.Sprint(w.reasons) != "[secondary rate limit ]" {
+		t.Errorf("do paused for %q, want the secondary rate limit and its resume", w.reasons)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		status int
+		header string
+		want   time.Duration
+	}{
+		{http.StatusForbidden, "30", 30 * time.Second},
+		{http.StatusTooManyRequests, "2", 2 * time.Second},
+		{http.StatusForbidden, "", 0},
+		{http.StatusForbidden, "0", 0},
+		{http.StatusForbidden, "-5", 0},
+		{http.StatusForbidden, "Wed, 21 Oct 2015 07:28:00 GMT", 0},
+		{http.StatusServiceUnavailable, "30", 0},
+		{http.StatusOK, "30", 0},
+	}
+	for _, tt := range tests {
+		resp := &github.Response{Response: &http.Response{StatusCode: tt.status, Header: http.Header{}}}
+		resp.Header.Set("Retry-After", tt.header)
+		if got := retryAfter(resp); got != tt.want {
+			t.Errorf("retryAfter of %d with %q = %s, want %s", tt.status, tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestDoRemaining checks the workers pause until the rate limit resets once
+// fewer than minRemaining requests are left, and resume after.
+func TestDoRemaining(t *testing.T) {
+	reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+	_, w, do, requests := get(t, func(n int, w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(minRemaining-1-n))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		fmt.Fprint(w, "{}")
+	})
+	if err := do(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.reasons) != 1 || w.reasons[0] != "rate limit almost used up" || !w.until[0].Equal(reset) {
+		t.Fatalf("do with %d requests left paused for %q until %v, want until %s", minRemaining-1, w.reasons, w.until, reset)
+	}
+	if err := do(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Now().Before(reset) {
+		t.Errorf("the second request was sent before the reset")
+	}
+	if *requests != 2 || len(w.reasons) < 2 || w.reasons[1] != "" {
+		t.Errorf("do paused for %q, want the pause resumed before the second request", w.reasons)
+	}
+
+	// enough requests left, or a reset already passed, don't pause
+	_, w, do, _ = get(t, func(n int, w http.ResponseWriter) {
+		remaining := minRemaining
+		if n > 0 {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+		fmt.Fprint(w, "{}")
+	})
+	for n := 0; n < 2; n++ {
+		if err := do(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.reasons) != 0 {
+		t.Errorf("do paused for %q, want no pause", w.reasons)
+	}
+}
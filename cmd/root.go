@@ -3,26 +3,93 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
-	// change storage backend
-	//	storage "github.com/tommyshem/ogi/cmd/storage/nutsdb"
-	storage "github.com/tommyshem/ogi/cmd/storage/bolt"
-	//storage "github.com/tommyshem/ogi/cmd/bolt"
+	"github.com/tommyshem/ogi/cmd/storage"
+	// storage backends, registered in their init functions
+	_ "github.com/tommyshem/ogi/cmd/storage/bolt"
+	_ "github.com/tommyshem/ogi/cmd/storage/nutsdb"
 )
 
 // global structs
-var db *storage.Store
-
-// var db *storage.NutsStore
+var db storage.Storage
 var config *Config
 
+// backendFlag holds the --backend persistent flag.
+var backendFlag string
+
+// noColor holds the --no-color persistent flag.
+var noColor bool
+
 var RootCmd = &cobra.Command{
 	Use:   "(OGI) Offline GitHub Issues",
 	Short: fmt.Sprintf("Offline GitHub Issues (v%s)", Version),
 	Long:  `OGI let's you download issues from a GitHub repo's to be made available offline.`,
 }
 
+// openStore opens the offline database for the current repo, exiting with a
+// hint to run fetch when no repo is configured yet or the repo wasn't
+// fetched.
+func openStore() {
+	config = LoadConfig()
+	if config.Repo == "" {
+		fmt.Println(`
+It looks like you haven't initialized OGI yet!
+
+The first time you run OGI you should run "ogi fetch owner/repo"
+or use --repo owner/repo to pick a repo that was fetched before.`)
+		os.Exit(-1)
+	}
+	root, err := storage.Open(backendName())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	s, err := openFetched(root, config.Owner, config.Repo)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	db = s
+}
+
+// openFetched returns the store of a repo of the database opened by root,
+// failing with a hint to run fetch when the repo was never fetched, so that
+// reading it doesn't leave an empty repo behind.
+func openFetched(root storage.Storage, owner string, repo string) (storage.Storage, error) {
+	repos, err := root.Repos()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repos {
+		if r.Owner == owner && r.Repo == repo {
+			return root.ForRepo(owner, repo)
+		}
+	}
+	return nil, fmt.Errorf(`%s/%s hasn't been fetched yet, run "ogi fetch %s/%s" first.`, owner, repo, owner, repo)
+}
+
+// backendName returns the storage backend to use: the --backend flag, then
+// the storage.backend key of the central config, then the default backend.
+func backendName() string {
+	if backendFlag != "" {
+		return backendFlag
+	}
+	if backend := LoadGlobalConfig().Storage.Backend; backend != "" {
+		return backend
+	}
+	return storage.DefaultBackend
+}
+
+// init sets up the flags shared by all commands.
+func init() {
+	storage.AppVersion = Version
+	RootCmd.PersistentFlags().StringVar(&repoFlag, "repo", "", "Use the tracked repo <owner/repo> instead of the current one")
+	RootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Print plain text without colors or Markdown rendering, also set by the NO_COLOR environment variable")
+	RootCmd.PersistentFlags().StringVar(&backendFlag, "backend", "", fmt.Sprintf("Storage backend to use <%s>", strings.Join(storage.Backends(), ", ")))
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+	"github.com/tommyshem/ogi/cmd/storage/nutsdb"
+)
+
+// TestOpenFetched checks opening a repo that was never fetched fails without
+// adding it to the database.
+func TestOpenFetched(t *testing.T) {
+	backends := map[string]func(dir string) (storage.Storage, error){
+		"bolt": func(dir string) (storage.Storage, error) {
+			return bolt.OpenAt(filepath.Join(dir, "issues.db"))
+		},
+		"nutsdb": func(dir string) (storage.Storage, error) {
+			return nutsdb.OpenAt(dir)
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			root, err := open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+			fetched, err := root.ForRepo("octo", "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fetched.Save(issue.Issue{Number: 1, State: "open", Title: "Crash"}); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := openFetched(root, "octo", "hello")
+			if err != nil {
+				t.Fatalf("openFetched of a fetched repo: %s", err)
+			}
+			if is, err := s.Get("1"); err != nil || is.Title != "Crash" {
+				t.Errorf("Get(1) = %q, %v, want the fetched issue", is.Title, err)
+			}
+
+			for _, r := range [][2]string{{"octo", "other"}, {"Octo", "hello"}, {"octo-hello", ""}} {
+				_, err := openFetched(root, r[0], r[1])
+				if err == nil || !strings.Contains(err.Error(), `run "ogi fetch `+r[0]+"/"+r[1]+`"`) {
+					t.Errorf("openFetched(%s/%s) = %v, want a hint to fetch it", r[0], r[1], err)
+				}
+			}
+			repos, err := root.Repos()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(repos) != 1 || repos[0].Owner != "octo" || repos[0].Repo != "hello" {
+				t.Errorf("Repos = %+v, want only octo/hello", repos)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/search"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search the issues of the repo.",
+	Long: `Search the stored issues of the repo with the qualifiers of GitHub's issue
+search, for example:
+
+	ogi search 'is:open label:bug author:alice -label:wontfix updated:>2025-01-01 crash'
+
+Qualifiers:
+
+	is:open, is:closed, is:issue, is:pr, is:merged, is:unmerged,
+	is:locked, is:unlocked, state:open, state:closed, type:issue, type:pr
+	label:NAME, author:USER, assignee:USER, milestone:TITLE
+	mentions:USER, commenter:USER, involves:USER
+	no:label, no:assignee, no:milestone
+	created:DATE, updated:DATE, closed:DATE, merged:DATE
+	comments:NUMBER
+	in:title, in:body, in:comments
+	sort:created, sort:updated, sort:comments, sort:reactions, sort:number,
+	each with -asc or -desc, like sort:updated-asc
+
+A leading - negates a term and comma separated values match any of them.
+Dates are 2006-01-02 in local time, RFC 3339 times or @today, less days,
+weeks, months or years with @today-7d, @today-2w, @today-1m or @today-1y.
+Numbers and dates take >, >=, <, <= or a range like 2025-01-01..2025-03-31,
+where * is an open bound. sort: orders the issues instead of the relevance,
+the highest first unless -asc is given, except for number.
+Double quotes keep spaces in a value or a phrase, as in label:"help wanted".
+
+Any other text is looked up in the full text index of the titles, bodies and
+comments, or where in: says. Words match whatever their ending, so crash
+finds crashes and crashing too, and the issues are ranked by relevance with
+the lines holding the words shown below them.
+Quote the query, or give it after --, so negated terms aren't read as flags.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("You need to give a search query!")
+			os.Exit(-1)
+		}
+		q, err := search.Parse(strings.Join(args, " "))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		openStore()
+		results, err := q.Run(db)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		printResults(results, false)
+	},
+}
+
+// printResults prints the titles of the issues found with their snippets, or
+// their raw JSON with the --raw flag. withRepo prefixes the titles with the
+// repo of the issues, for results from several repos.
+func printResults(results []search.Result, withRepo bool) {
+	if raw {
+		issues := []issue.Issue{}
+		for _, r := range results {
+			issues = append(issues, r.Issue)
+		}
+		printIssues(issues)
+		return
+	}
+	for _, r := range results {
+		if withRepo {
+			fmt.Printf("%s/%s#", r.Repo.Owner, r.Repo.Repo)
+		}
+		fmt.Print(r.Issue.FmtTitle())
+		for _, snippet := range r.Snippets {
+			fmt.Printf("\t%s\n", snippet)
+		}
+	}
+	fmt.Printf("\n=== (%d) Issues ===\n", len(results))
+}
+
+// init registers the search command with the root command and sets up flags
+// on the search command.
+func init() {
+	RootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().BoolVarP(&raw, "raw", "r", false, "Show the raw JSON for these issues")
+}
@@ -0,0 +1,305 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// plain returns a term that doesn't need the comments.
+func plain(match func(i issue.Issue) bool) term {
+	return term{match: func(i issue.Issue, comments func() ([]issue.Comment, error)) (bool, error) {
+		return match(i), nil
+	}}
+}
+
+// anyOf returns a term matching the issues any of the matchers match.
+func anyOf(matchers []func(issue.Issue) bool) term {
+	return plain(func(i issue.Issue) bool {
+		for _, m := range matchers {
+			if m(i) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// anyValue returns a term matching the issues match reports for any of the
+// values.
+func anyValue(values []string, match func(i issue.Issue, v string) bool) term {
+	return plain(func(i issue.Issue) bool {
+		for _, v := range values {
+			if match(i, v) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// commentTerm returns a term like anyValue for a match that needs the
+// comments of the issue.
+func commentTerm(values []string, match func(i issue.Issue, comments []issue.Comment, v string) bool) term {
+	return term{comments: true, match: func(i issue.Issue, comments func() ([]issue.Comment, error)) (bool, error) {
+		c, err := comments()
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if match(i, c, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}}
+}
+
+// isMatcher returns the matcher of a value of the is:, state: or type:
+// qualifiers.
+func isMatcher(key string, v string) (func(issue.Issue) bool, error) {
+	switch {
+	case v == "open" && key != "type":
+		return func(i issue.Issue) bool { return i.State == "open" }, nil
+	case v == "closed" && key != "type":
+		return func(i issue.Issue) bool { return i.State == "closed" }, nil
+	case v == "issue" && key != "state":
+		return func(i issue.Issue) bool { return !i.IsPull }, nil
+	case (v == "pr" || v == "pull") && key != "state":
+		return func(i issue.Issue) bool { return i.IsPull }, nil
+	case v == "merged" && key == "is":
+		return func(i issue.Issue) bool { return i.PullRequest != nil && i.PullRequest.Merged }, nil
+	case v == "unmerged" && key == "is":
+		return func(i issue.Issue) bool { return i.IsPull && (i.PullRequest == nil || !i.PullRequest.Merged) }, nil
+	case v == "locked" && key == "is":
+		return func(i issue.Issue) bool { return i.Locked }, nil
+	case v == "unlocked" && key == "is":
+		return func(i issue.Issue) bool { return !i.Locked }, nil
+	}
+	return nil, fmt.Errorf("unknown value %q for %s:", v, key)
+}
+
+// login returns a login given to a qualifier without its leading @.
+func login(v string) string {
+	return strings.TrimPrefix(v, "@")
+}
+
+func isAuthor(i issue.Issue, v string) bool {
+	return strings.EqualFold(i.User.Login, login(v))
+}
+
+func isAssignee(i issue.Issue, v string) bool {
+	for _, a := range i.Assignees {
+		if strings.EqualFold(a.Login, login(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func commented(i issue.Issue, comments []issue.Comment, v string) bool {
+	for _, c := range comments {
+		if strings.EqualFold(c.User.Login, login(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func mentions(i issue.Issue, comments []issue.Comment, v string) bool {
+	i.Comments = comments
+	return i.Mentions(login(v))
+}
+
+// timeField returns the getter of the time a date qualifier compares.
+func timeField(key string) func(i issue.Issue) *time.Time {
+	switch key {
+	case "created":
+		return func(i issue.Issue) *time.Time { return &i.CreatedAt }
+	case "updated":
+		return func(i issue.Issue) *time.Time { return &i.UpdatedAt }
+	case "closed":
+		return func(i issue.Issue) *time.Time { return i.ClosedAt }
+	}
+	return func(i issue.Issue) *time.Time {
+		if i.PullRequest == nil {
+			return nil
+		}
+		return i.PullRequest.MergedAt
+	}
+}
+
+// timeRange is the range of times from from to to, to excluded. A zero
+// bound is open.
+type timeRange struct {
+	from time.Time
+	to   time.Time
+}
+
+func (r timeRange) contains(t time.Time) bool {
+	t = t.Truncate(time.Second)
+	return (r.from.IsZero() || !t.Before(r.from)) && (r.to.IsZero() || t.Before(r.to))
+}
+
+// parseTimeRange parses a date, a date after a comparison operator (>, >=,
+// <, <=) or a range of dates a..b where * is an open bound. A day covers the
+// whole day in local time.
+func parseTimeRange(s string) (timeRange, error) {
+	if a, b, ok := strings.Cut(s, ".."); ok {
+		r := timeRange{}
+		if a != "*" {
+			from, _, err := parseTime(a)
+			if err != nil {
+				return r, err
+			}
+			r.from = from
+		}
+		if b != "*" {
+			t, width, err := parseTime(b)
+			if err != nil {
+				return r, err
+			}
+			r.to = t.Add(width)
+		}
+		return r, nil
+	}
+	op, value := cutOperator(s)
+	t, width, err := parseTime(value)
+	if err != nil {
+		return timeRange{}, err
+	}
+	switch op {
+	case ">":
+		return timeRange{from: t.Add(width)}, nil
+	case ">=":
+		return timeRange{from: t}, nil
+	case "<":
+		return timeRange{to: t}, nil
+	case "<=":
+		return timeRange{to: t.Add(width)}, nil
+	}
+	return timeRange{from: t, to: t.Add(width)}, nil
+}
+
+// parseTime parses a day in local time or a time, in RFC 3339 or without
+// its zone in local time. It returns the start of the day or time and how
+// long it lasts. @today is the current day, @today-7d the day a week before,
+// with d, w, m or y for days, weeks, months or years, which keeps saved
+// searches meaning the same day after day.
+func parseTime(s string) (time.Time, time.Duration, error) {
+	if rest, ok := strings.CutPrefix(strings.ToLower(s), "@today"); ok {
+		now := time.Now()
+		t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		if rest != "" {
+			offset, err := parseOffset(rest)
+			if err != nil {
+				return time.Time{}, 0, err
+			}
+			t = offset(t)
+		}
+		return t, t.AddDate(0, 0, 1).Sub(t), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, t.AddDate(0, 0, 1).Sub(t), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, time.Second, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, time.Second, nil
+	}
+	return time.Time{}, 0, fmt.Errorf("want a date like 2006-01-02 or 2006-01-02T15:04:05Z, not %q", s)
+}
+
+// parseOffset parses the -7d of @today-7d, returning a func moving a day
+// back by it.
+func parseOffset(s string) (func(time.Time) time.Time, error) {
+	bad := fmt.Errorf("want a day like @today or @today-7d, with d, w, m or y, not \"@today%s\"", s)
+	if len(s) < 3 || s[0] != '-' {
+		return nil, bad
+	}
+	n, err := strconv.Atoi(s[1 : len(s)-1])
+	if err != nil || n < 0 {
+		return nil, bad
+	}
+	switch s[len(s)-1] {
+	case 'd':
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, -n) }, nil
+	case 'w':
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, -7*n) }, nil
+	case 'm':
+		return func(t time.Time) time.Time { return t.AddDate(0, -n, 0) }, nil
+	case 'y':
+		return func(t time.Time) time.Time { return t.AddDate(-n, 0, 0) }, nil
+	}
+	return nil, bad
+}
+
+// numberRange is the range of numbers from min to max, both included.
+type numberRange struct {
+	min int
+	max int
+}
+
+func (r numberRange) contains(n int) bool {
+	return n >= r.min && n <= r.max
+}
+
+// parseNumberRange parses a number, a number after a comparison operator or
+// a range of numbers a..b where * is an open bound.
+func parseNumberRange(s string) (numberRange, error) {
+	r := numberRange{math.MinInt, math.MaxInt}
+	number := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("want a number, not %q", s)
+		}
+		return n, nil
+	}
+	var err error
+	if a, b, ok := strings.Cut(s, ".."); ok {
+		if a != "*" {
+			if r.min, err = number(a); err != nil {
+				return r, err
+			}
+		}
+		if b != "*" {
+			if r.max, err = number(b); err != nil {
+				return r, err
+			}
+		}
+		return r, nil
+	}
+	op, value := cutOperator(s)
+	n, err := number(value)
+	if err != nil {
+		return r, err
+	}
+	switch op {
+	case ">":
+		r.min = n + 1
+	case ">=":
+		r.min = n
+	case "<":
+		r.max = n - 1
+	case "<=":
+		r.max = n
+	default:
+		r.min, r.max = n, n
+	}
+	return r, nil
+}
+
+// cutOperator splits the comparison operator off the start of a value.
+func cutOperator(s string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):]
+		}
+	}
+	return "", s
+}
@@ -0,0 +1,208 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+	now := time.Now()
+	today := day(now.Year(), now.Month(), now.Day())
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  timeRange
+	}{
+		{"2025-01-01", timeRange{day(2025, 1, 1), day(2025, 1, 2)}},
+		{">2025-01-01", timeRange{from: day(2025, 1, 2)}},
+		{">=2025-01-01", timeRange{from: day(2025, 1, 1)}},
+		{"<2025-01-01", timeRange{to: day(2025, 1, 1)}},
+		{"<=2025-01-01", timeRange{to: day(2025, 1, 2)}},
+		{"2025-01-01..2025-03-31", timeRange{day(2025, 1, 1), day(2025, 4, 1)}},
+		{"2025-01-01..*", timeRange{from: day(2025, 1, 1)}},
+		{"*..2025-03-31", timeRange{to: day(2025, 4, 1)}},
+		{"2025-01-02T15:04:05Z", timeRange{at, at.Add(time.Second)}},
+		{">2025-01-02T15:04:05Z", timeRange{from: at.Add(time.Second)}},
+		{"@today", timeRange{today, today.AddDate(0, 0, 1)}},
+		{"@today-7d", timeRange{today.AddDate(0, 0, -7), today.AddDate(0, 0, -6)}},
+		{"<@today-7d", timeRange{to: today.AddDate(0, 0, -7)}},
+		{">=@today-2w", timeRange{from: today.AddDate(0, 0, -14)}},
+		{"@TODAY-1m..@today", timeRange{today.AddDate(0, -1, 0), today.AddDate(0, 0, 1)}},
+		{"@today-1y..*", timeRange{from: today.AddDate(-1, 0, 0)}},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeRange(tt.value)
+		if err != nil {
+			t.Errorf("parseTimeRange(%q): %s", tt.value, err)
+			continue
+		}
+		if !got.from.Equal(tt.want.from) || !got.to.Equal(tt.want.to) {
+			t.Errorf("parseTimeRange(%q) = %s..%s, want %s..%s", tt.value, got.from, got.to, tt.want.from, tt.want.to)
+		}
+	}
+	for _, value := range []string{"yesterday", "2025-13-01", "@today-d", "@today-7", "@today+7d", "@today--7d", "2025-01-01..soon"} {
+		if _, err := parseTimeRange(value); err == nil {
+			t.Errorf("parseTimeRange(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestParseNumberRange(t *testing.T) {
+	tests := []struct {
+		value   string
+		in, out []int
+	}{
+		{"3", []int{3}, []int{2, 4}},
+		{">3", []int{4, 100}, []int{3}},
+		{">=3", []int{3, 4}, []int{2}},
+		{"<3", []int{0, 2}, []int{3}},
+		{"<=3", []int{3}, []int{4}},
+		{"2..4", []int{2, 3, 4}, []int{1, 5}},
+		{"2..*", []int{2, 1000}, []int{1}},
+		{"*..2", []int{0, 2}, []int{3}},
+	}
+	for _, tt := range tests {
+		r, err := parseNumberRange(tt.value)
+		if err != nil {
+			t.Errorf("parseNumberRange(%q): %s", tt.value, err)
+			continue
+		}
+		for _, n := range tt.in {
+			if !r.contains(n) {
+				t.Errorf("parseNumberRange(%q) doesn't contain %d", tt.value, n)
+			}
+		}
+		for _, n := range tt.out {
+			if r.contains(n) {
+				t.Errorf("parseNumberRange(%q) contains %d", tt.value, n)
+			}
+		}
+	}
+	for _, value := range []string{"many", ">", "1..x", "1.5"} {
+		if _, err := parseNumberRange(value); err == nil {
+			t.Errorf("parseNumberRange(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.Local) }
+	merged := day(2025, 2, 1)
+	issues := []issue.Issue{
+		{
+			Number: 1, State: "open", Title: "Crash on start",
+			Body:         "cc @dave",
+			User:         issue.User{Login: "alice"},
+			Labels:       []issue.Label{{Name: "bug"}, {Name: "a,b"}},
+			Assignees:    []issue.User{{Login: "bob"}},
+			Milestone:    &issue.Milestone{Title: "v1 final"},
+			CommentCount: 3,
+			CreatedAt:    day(2025, 1, 10),
+			UpdatedAt:    day(2025, 3, 1),
+		},
+		{
+			Number: 2, State: "closed", Title: "Add a flag",
+			User:        issue.User{Login: "bob"},
+			Labels:      []issue.Label{{Name: "wontfix"}},
+			Locked:      true,
+			CreatedAt:   day(2024, 12, 1),
+			UpdatedAt:   day(2025, 2, 1),
+			ClosedAt:    &merged,
+			IsPull:      true,
+			PullRequest: &issue.PullRequest{Merged: true, MergedAt: &merged},
+		},
+		{
+			Number: 3, State: "open", Title: "Draft",
+			User:      issue.User{Login: "carol"},
+			CreatedAt: day(2025, 1, 20),
+			UpdatedAt: day(2025, 1, 20),
+			IsPull:    true,
+		},
+	}
+	comments := map[int][]issue.Comment{
+		1: {{User: issue.User{Login: "carol"}, Body: "same here"}, {User: issue.User{Login: "erin"}, Body: "ping @frank"}},
+	}
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"", "[1 2 3]"},
+		{"is:open", "[1 3]"},
+		{"-is:open", "[2]"},
+		{"state:closed", "[2]"},
+		{"is:issue", "[1]"},
+		{"is:pr", "[2 3]"},
+		{"type:pull", "[2 3]"},
+		{"is:merged", "[2]"},
+		{"is:unmerged", "[3]"},
+		{"is:locked", "[2]"},
+		{"is:open,merged", "[1 2 3]"},
+		{"is:open is:pr", "[3]"},
+		{"label:bug", "[1]"},
+		{"label:BUG", "[1]"},
+		{"-label:wontfix", "[1 3]"},
+		{`label:"a,b"`, "[1]"},
+		{`label:"a,b",wontfix`, "[1 2]"},
+		{"label:a", "[]"},
+		{"label:bug label:wontfix", "[]"},
+		{"-label:bug -label:wontfix", "[3]"},
+		{"author:@alice", "[1]"},
+		{"-author:alice", "[2 3]"},
+		{"author:alice,carol", "[1 3]"},
+		{"assignee:bob", "[1]"},
+		{`milestone:"v1 final"`, "[1]"},
+		{"no:label", "[3]"},
+		{"no:assignee", "[2 3]"},
+		{"-no:milestone", "[1]"},
+		{"commenter:carol", "[1]"},
+		{"-commenter:carol", "[2 3]"},
+		{"mentions:dave", "[1]"},
+		{"mentions:frank", "[1]"},
+		{"involves:bob", "[1 2]"},
+		{"involves:erin", "[1]"},
+		{"comments:3", "[1]"},
+		{"comments:>0", "[1]"},
+		{"comments:0..2", "[2 3]"},
+		{"created:2025-01-10", "[1]"},
+		{"created:>=2025-01-01", "[1 3]"},
+		{"created:<2025-01-01", "[2]"},
+		{"created:2025-01-01..2025-01-15", "[1]"},
+		{"-created:2025-01-01..2025-01-15", "[2 3]"},
+		{"updated:>2025-02-01", "[1]"},
+		{"closed:2025-02-01", "[2]"},
+		{"merged:*..2025-12-31", "[2]"},
+		{"created:>@today-7d", "[]"},
+		{"created:<@today-7d", "[1 2 3]"},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.search)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.search, err)
+			continue
+		}
+		got := []int{}
+		for _, i := range issues {
+			loaded := false
+			ok, err := q.Match(i, func() ([]issue.Comment, error) {
+				if loaded {
+					t.Errorf("Match(%q) loaded the comments of #%d twice", tt.search, i.Number)
+				}
+				loaded = true
+				return comments[i.Number], nil
+			})
+			if err != nil {
+				t.Errorf("Match(%q) #%d: %s", tt.search, i.Number, err)
+			}
+			if ok {
+				got = append(got, i.Number)
+			}
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("search %q matched %v, want %s", tt.search, got, tt.want)
+		}
+	}
+}
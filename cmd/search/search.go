@@ -0,0 +1,312 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// Query is a parsed search, in the qualifier syntax of GitHub's issue search:
+//
+//	is:open label:bug author:alice -label:wontfix updated:>2025-01-01 crash
+//
+// Every term must match. A leading - negates a term, comma separated values
+// of a qualifier match any of them and double quotes keep spaces in a value
+// or a phrase. Text that isn't a qualifier is looked up in the full text
+// index of the title, body and comments, or where in: says.
+type Query struct {
+	terms []term
+	text  []text
+	// scopes are the fields the text is looked for in.
+	scopes []string
+	// store holds the terms the stores can look up in their indexes.
+	store storage.Query
+}
+
+// term is one qualifier or piece of text of a search.
+type term struct {
+	negated bool
+	// comments is set when the term needs the comments of the issue.
+	comments bool
+	match    func(i issue.Issue, comments func() ([]issue.Comment, error)) (bool, error)
+}
+
+// token is a term as written in the search, before it is parsed.
+type token struct {
+	negated bool
+	// key is the lower cased qualifier, empty for text.
+	key    string
+	values []string
+}
+
+// qualifiers are the known qualifier keys, any other word:value is text.
+var qualifiers = map[string]bool{
+	"is": true, "state": true, "type": true, "no": true, "in": true,
+	"label": true, "author": true, "assignee": true, "mentions": true,
+	"commenter": true, "involves": true, "milestone": true,
+	"created": true, "updated": true, "closed": true, "merged": true,
+	"comments": true, "sort": true,
+}
+
+// Parse parses a search.
+func Parse(s string) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{}
+	for _, t := range tokens {
+		for _, v := range t.values {
+			if v == "" && t.key != "" {
+				return nil, fmt.Errorf("%s: needs a value", t.key)
+			}
+		}
+		switch t.key {
+		case "":
+			if terms := fulltext.Terms(t.values[0]); len(terms) > 0 {
+				q.text = append(q.text, text{negated: t.negated, terms: terms})
+			}
+			continue
+		case "in":
+			if t.negated {
+				return nil, fmt.Errorf("in: can't be negated")
+			}
+			for _, v := range t.values {
+				v = strings.ToLower(v)
+				if v != "title" && v != "body" && v != "comments" {
+					return nil, fmt.Errorf("unknown value %q for in:, want title, body or comments", v)
+				}
+				q.scopes = append(q.scopes, v)
+			}
+			continue
+		case "sort":
+			if t.negated || len(t.values) > 1 {
+				return nil, fmt.Errorf("sort: takes one field, like sort:updated-desc")
+			}
+			field, direction, _ := strings.Cut(strings.ToLower(t.values[0]), "-")
+			if direction != "" && direction != "asc" && direction != "desc" {
+				return nil, fmt.Errorf("sort: wants asc or desc after the field, not %q", direction)
+			}
+			desc := field != "number"
+			if direction != "" {
+				desc = direction == "desc"
+			}
+			if err := q.OrderBy(field, desc); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tm, err := q.qualifier(t)
+		if err != nil {
+			return nil, err
+		}
+		tm.negated = t.negated
+		q.terms = append(q.terms, tm)
+	}
+	if len(q.scopes) == 0 {
+		q.scopes = []string{"title", "body", "comments"}
+	}
+	// check the terms that don't need the comments first
+	sort.SliceStable(q.terms, func(a, b int) bool {
+		return !q.terms[a].comments && q.terms[b].comments
+	})
+	return q, nil
+}
+
+// Storage returns the part of the search the stores can look up in their
+// indexes. It matches all the issues the search does, and maybe more.
+func (q *Query) Storage() storage.Query {
+	return q.store
+}
+
+// Order returns the field the results are sorted by and whether from the
+// highest value down. The field is empty for results ranked by relevance, or
+// ordered by number when the search has no text.
+func (q *Query) Order() (string, bool) {
+	return q.store.Sort, q.store.Desc
+}
+
+// OrderBy sorts the results by a field of storage.Sorts instead of by
+// relevance, as sort: does.
+func (q *Query) OrderBy(field string, desc bool) error {
+	if !slices.Contains(storage.Sorts, field) {
+		return fmt.Errorf("results can't be sorted by %q, only by %s", field, strings.Join(storage.Sorts, ", "))
+	}
+	q.store.Sort, q.store.Desc = field, desc
+	return nil
+}
+
+// Match reports whether the issue matches every term of the search. The
+// comments are only asked for when a term needs them.
+func (q *Query) Match(i issue.Issue, comments func() ([]issue.Comment, error)) (bool, error) {
+	var loaded []issue.Comment
+	var err error
+	once := false
+	cached := func() ([]issue.Comment, error) {
+		if !once {
+			loaded, err = comments()
+			once = true
+		}
+		return loaded, err
+	}
+	for _, t := range q.terms {
+		ok, err := t.match(i, cached)
+		if err != nil {
+			return false, err
+		}
+		if ok == t.negated {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// tokenize splits a search on the spaces outside of double quotes, and
+// splits qualifiers into their key and comma separated values.
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	rs := []rune(s)
+	for n := 0; n < len(rs); {
+		if unicode.IsSpace(rs[n]) {
+			n++
+			continue
+		}
+		start := n
+		t := token{}
+		if rs[n] == '-' && n+1 < len(rs) && !unicode.IsSpace(rs[n+1]) {
+			t.negated = true
+			n++
+		}
+		cur := strings.Builder{}
+		quoted := false
+		inQuote := false
+		for ; n < len(rs) && (inQuote || !unicode.IsSpace(rs[n])); n++ {
+			r := rs[n]
+			switch {
+			case r == '"':
+				inQuote = !inQuote
+				quoted = true
+			case r == ':' && t.key == "" && !quoted && qualifiers[strings.ToLower(cur.String())]:
+				t.key = strings.ToLower(cur.String())
+				cur.Reset()
+			case r == ',' && t.key != "" && !inQuote:
+				t.values = append(t.values, cur.String())
+				cur.Reset()
+			default:
+				cur.WriteRune(r)
+			}
+		}
+		if inQuote {
+			return nil, fmt.Errorf("missing closing quote in %s", string(rs[start:]))
+		}
+		t.values = append(t.values, cur.String())
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// qualifier returns the term of a qualifier token, and adds it to the
+// storage query when an index can look it up.
+func (q *Query) qualifier(t token) (term, error) {
+	indexed := !t.negated && len(t.values) == 1
+	value := t.values[0]
+	switch t.key {
+	case "is", "state", "type":
+		matchers := []func(issue.Issue) bool{}
+		for _, v := range t.values {
+			m, err := isMatcher(t.key, strings.ToLower(v))
+			if err != nil {
+				return term{}, err
+			}
+			matchers = append(matchers, m)
+		}
+		if v := strings.ToLower(value); indexed && (v == "open" || v == "closed") && t.key != "type" {
+			q.store.State = v
+		}
+		return anyOf(matchers), nil
+	case "label":
+		if !t.negated {
+			q.store.Labels = append(q.store.Labels, t.values)
+		}
+		return anyValue(t.values, func(i issue.Issue, v string) bool {
+			for _, l := range i.Labels {
+				if strings.EqualFold(l.Name, v) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case "author":
+		if indexed && q.store.Author == "" {
+			q.store.Author = login(value)
+		}
+		return anyValue(t.values, isAuthor), nil
+	case "assignee":
+		if indexed && q.store.Assignee == "" {
+			q.store.Assignee = login(value)
+		}
+		return anyValue(t.values, isAssignee), nil
+	case "milestone":
+		if indexed && q.store.Milestone == "" {
+			q.store.Milestone = value
+		}
+		return anyValue(t.values, func(i issue.Issue, v string) bool {
+			return i.Milestone != nil && strings.EqualFold(i.Milestone.Title, v)
+		}), nil
+	case "mentions":
+		return commentTerm(t.values, mentions), nil
+	case "commenter":
+		return commentTerm(t.values, commented), nil
+	case "involves":
+		return commentTerm(t.values, func(i issue.Issue, comments []issue.Comment, v string) bool {
+			return isAuthor(i, v) || isAssignee(i, v) || commented(i, comments, v) || mentions(i, comments, v)
+		}), nil
+	case "no":
+		matchers := []func(issue.Issue) bool{}
+		for _, v := range t.values {
+			switch strings.ToLower(v) {
+			case "label":
+				matchers = append(matchers, func(i issue.Issue) bool { return len(i.Labels) == 0 })
+			case "assignee":
+				matchers = append(matchers, func(i issue.Issue) bool { return len(i.Assignees) == 0 })
+			case "milestone":
+				matchers = append(matchers, func(i issue.Issue) bool { return i.Milestone == nil })
+			default:
+				return term{}, fmt.Errorf("unknown value %q for no:, want label, assignee or milestone", v)
+			}
+		}
+		return anyOf(matchers), nil
+	case "created", "updated", "closed", "merged":
+		if len(t.values) > 1 {
+			return term{}, fmt.Errorf("%s: takes one date or range", t.key)
+		}
+		r, err := parseTimeRange(value)
+		if err != nil {
+			return term{}, fmt.Errorf("%s: %v", t.key, err)
+		}
+		if t.key == "updated" && indexed && q.store.UpdatedSince.IsZero() && q.store.UpdatedBefore.IsZero() {
+			q.store.UpdatedSince, q.store.UpdatedBefore = r.from, r.to
+		}
+		field := timeField(t.key)
+		return plain(func(i issue.Issue) bool {
+			at := field(i)
+			return at != nil && r.contains(*at)
+		}), nil
+	case "comments":
+		if len(t.values) > 1 {
+			return term{}, fmt.Errorf("comments: takes one number or range")
+		}
+		r, err := parseNumberRange(value)
+		if err != nil {
+			return term{}, fmt.Errorf("comments: %v", err)
+		}
+		return plain(func(i issue.Issue) bool { return r.contains(i.CommentCount) }), nil
+	}
+	return term{}, fmt.Errorf("unknown qualifier %s:", t.key)
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []token
+	}{
+		{"crash", []token{{values: []string{"crash"}}}},
+		{"-crash", []token{{negated: true, values: []string{"crash"}}}},
+		{"- crash", []token{{values: []string{"-"}}, {values: []string{"crash"}}}},
+		{"label:bug,ui", []token{{key: "label", values: []string{"bug", "ui"}}}},
+		{"-label:wontfix", []token{{negated: true, key: "label", values: []string{"wontfix"}}}},
+		{"Label:Bug", []token{{key: "label", values: []string{"Bug"}}}},
+		{`label:"help wanted",bug`, []token{{key: "label", values: []string{"help wanted", "bug"}}}},
+		{`label:"a,b",c`, []token{{key: "label", values: []string{"a,b", "c"}}}},
+		{`milestone:"v1, final"`, []token{{key: "milestone", values: []string{"v1, final"}}}},
+		// commas only split the values of qualifiers
+		{"crash,hang", []token{{values: []string{"crash,hang"}}}},
+		// an unknown word: is text, as is a quoted one
+		{"foo:bar", []token{{values: []string{"foo:bar"}}}},
+		{`"label":bug`, []token{{values: []string{"label:bug"}}}},
+		{`"out of range" is:open`, []token{{values: []string{"out of range"}}, {key: "is", values: []string{"open"}}}},
+		{"  is:open \t crash ", []token{{key: "is", values: []string{"open"}}, {values: []string{"crash"}}}},
+		{"label:", []token{{key: "label", values: []string{""}}}},
+	}
+	for _, tt := range tests {
+		got, err := tokenize(tt.search)
+		if err != nil {
+			t.Errorf("tokenize(%q): %s", tt.search, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %+v, want %+v", tt.search, got, tt.want)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []text
+	}{
+		{"crash", []text{{terms: fulltext.Terms("crash")}}},
+		{"-crash", []text{{negated: true, terms: fulltext.Terms("crash")}}},
+		{`"out of range"`, []text{{terms: fulltext.Terms("out of range")}}},
+		{"foo:bar", []text{{terms: fulltext.Terms("foo bar")}}},
+		{"is:open", nil},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.search)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.search, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.text, tt.want) {
+			t.Errorf("Parse(%q) text = %+v, want %+v", tt.search, q.text, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, search := range []string{
+		`"out of range`,
+		"label:",
+		"author:alice,",
+		"is:weird",
+		"type:open",
+		"state:pr",
+		"no:reviewer",
+		"in:nowhere",
+		"-in:title",
+		"sort:bogus",
+		"sort:updated-up",
+		"-sort:updated",
+		"sort:updated,created",
+		"created:yesterday",
+		"updated:2025-01-01,2025-02-01",
+		"created:@today+7d",
+		"created:@today-7x",
+		"comments:many",
+		"comments:1,2",
+	} {
+		if _, err := Parse(search); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", search)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		search string
+		field  string
+		desc   bool
+	}{
+		{"crash", "", false},
+		{"sort:number", "number", false},
+		{"sort:created", "created", true},
+		{"sort:updated", "updated", true},
+		{"sort:comments", "comments", true},
+		{"sort:reactions", "reactions", true},
+		{"sort:number-desc", "number", true},
+		{"sort:updated-asc", "updated", false},
+		{"Sort:Created-Desc", "created", true},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.search)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.search, err)
+			continue
+		}
+		if field, desc := q.Order(); field != tt.field || desc != tt.desc {
+			t.Errorf("Parse(%q) orders by %q desc %t, want %q desc %t", tt.search, field, desc, tt.field, tt.desc)
+		}
+	}
+}
+
+// TestStorage checks which terms of a search are looked up in the indexes of
+// the stores: the qualifiers with a single value that isn't negated.
+func TestStorage(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+	tests := []struct {
+		search string
+		want   storage.Query
+	}{
+		{"crash", storage.Query{}},
+		{"is:open", storage.Query{State: "open"}},
+		{"state:closed", storage.Query{State: "closed"}},
+		{"is:open,closed", storage.Query{}},
+		{"-is:open", storage.Query{}},
+		{"is:pr", storage.Query{}},
+		{"label:bug", storage.Query{Labels: [][]string{{"bug"}}}},
+		{"label:bug,ui label:p1", storage.Query{Labels: [][]string{{"bug", "ui"}, {"p1"}}}},
+		{"-label:wontfix", storage.Query{}},
+		{"author:@alice", storage.Query{Author: "alice"}},
+		{"author:alice,bob", storage.Query{}},
+		{"author:alice author:bob", storage.Query{Author: "alice"}},
+		{"-author:alice", storage.Query{}},
+		{"assignee:bob", storage.Query{Assignee: "bob"}},
+		{`milestone:"v1 final"`, storage.Query{Milestone: "v1 final"}},
+		{"mentions:carol commenter:dave involves:erin", storage.Query{}},
+		{"updated:>=2025-01-01", storage.Query{UpdatedSince: day(2025, 1, 1)}},
+		{"updated:2025-01-01..2025-03-31", storage.Query{UpdatedSince: day(2025, 1, 1), UpdatedBefore: day(2025, 4, 1)}},
+		{"-updated:>2025-01-01", storage.Query{}},
+		{"created:>2025-01-01 closed:<2025-01-01", storage.Query{}},
+		{"sort:comments", storage.Query{Sort: "comments", Desc: true}},
+		{
+			"is:open label:bug author:alice -label:wontfix updated:<2025-02-01 crash sort:updated-asc",
+			storage.Query{State: "open", Labels: [][]string{{"bug"}}, Author: "alice", UpdatedBefore: day(2025, 2, 1), Sort: "updated"},
+		},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.search)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.search, err)
+			continue
+		}
+		if got := q.Storage(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q).Storage() = %+v, want %+v", tt.search, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package search
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// maxSnippets is the number of snippets shown for an issue.
+const maxSnippets = 3
+
+// text is a word or phrase of a search, as the terms of the full text index.
+type text struct {
+	negated bool
+	terms   []string
+}
+
+// Result is an issue found by a search.
+type Result struct {
+	// Repo is the repo of the store the issue was found in.
+	Repo  storage.Repo
+	Issue issue.Issue
+	// Score is the BM25 relevance of the issue to the text searched for,
+	// zero for a search without text.
+	Score float64
+	// Snippets are lines of the issue holding the text searched for.
+	Snippets []string
+}
+
+// textMatches are the issues found in the full text index.
+type textMatches struct {
+	// scores are the relevance of the issues holding every word and phrase
+	// searched for, nil when the search has no text that isn't negated.
+	scores map[int]float64
+	// excluded are the issues holding a negated word or phrase.
+	excluded map[int]bool
+	// inComments are the issues holding some of the text in a comment.
+	inComments map[int]bool
+}
+
+// Run runs the search on the issues of a store. A search with text returns
+// them ranked by relevance, with snippets of the lines holding the text,
+// otherwise they are ordered by number, unless the search has an order.
+func (q *Query) Run(s storage.Storage) ([]Result, error) {
+	candidates, err := s.Query(q.store)
+	if err != nil {
+		return nil, err
+	}
+	found := &textMatches{excluded: map[int]bool{}}
+	if len(q.text) > 0 {
+		if found, err = q.findText(s); err != nil {
+			return nil, err
+		}
+	}
+	repo := s.Repository()
+	results := []Result{}
+	for _, i := range candidates {
+		score, ok := found.scores[i.Number]
+		if found.excluded[i.Number] || found.scores != nil && !ok {
+			continue
+		}
+		number := i.Number
+		ok, err := q.Match(i, func() ([]issue.Comment, error) {
+			return s.Comments(number)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, Result{Repo: repo, Issue: i, Score: score})
+		}
+	}
+	if found.scores == nil {
+		return results, nil
+	}
+	if q.store.Sort == "" {
+		sort.SliceStable(results, func(a, b int) bool {
+			return results[a].Score > results[b].Score
+		})
+	}
+	for n := range results {
+		if results[n].Snippets, err = q.snippets(s, results[n].Issue, found.inComments[results[n].Issue.Number]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// findText looks up the words and phrases of the search in the full text
+// index of the store.
+func (q *Query) findText(s storage.Storage) (*textMatches, error) {
+	list, err := s.TextDocs()
+	if err != nil {
+		return nil, err
+	}
+	docs := map[int]fulltext.Doc{}
+	total := 0
+	for _, d := range list {
+		docs[d.Number] = d
+		total += d.Length
+	}
+	avgLength := 0.0
+	if len(docs) > 0 {
+		avgLength = float64(total) / float64(len(docs))
+	}
+
+	cache := map[string]map[int][]int{}
+	postings := func(term string) (map[int][]int, error) {
+		if p, ok := cache[term]; ok {
+			return p, nil
+		}
+		list, err := s.Postings(term)
+		if err != nil {
+			return nil, err
+		}
+		p := map[int][]int{}
+		for _, posting := range list {
+			p[posting.Number] = posting.Positions
+		}
+		cache[term] = p
+		return p, nil
+	}
+
+	found := &textMatches{excluded: map[int]bool{}, inComments: map[int]bool{}}
+	for _, t := range q.text {
+		first, err := postings(t.terms[0])
+		if err != nil {
+			return nil, err
+		}
+		rest := []map[int][]int{}
+		for _, term := range t.terms[1:] {
+			p, err := postings(term)
+			if err != nil {
+				return nil, err
+			}
+			rest = append(rest, p)
+		}
+		// count where the terms follow each other in the fields searched
+		counts := map[int]int{}
+		for number, positions := range first {
+			d, ok := docs[number]
+			if !ok {
+				continue
+			}
+			for _, p := range positions {
+				field := d.Field(p)
+				if !slices.Contains(q.scopes, field) || !follows(rest, number, p) {
+					continue
+				}
+				counts[number]++
+				if field == "comments" && !t.negated {
+					found.inComments[number] = true
+				}
+			}
+		}
+		if t.negated {
+			for number := range counts {
+				found.excluded[number] = true
+			}
+			continue
+		}
+		scores := map[int]float64{}
+		for number, count := range counts {
+			if previous, ok := found.scores[number]; ok || found.scores == nil {
+				scores[number] = previous + fulltext.BM25(count, docs[number].Length, len(docs), len(counts), avgLength)
+			}
+		}
+		found.scores = scores
+	}
+	return found, nil
+}
+
+// follows reports whether the terms of rest are found one after the other
+// in the issue, right after the position of the first term.
+func follows(rest []map[int][]int, number int, position int) bool {
+	for n, p := range rest {
+		positions := p[number]
+		at := sort.SearchInts(positions, position+n+1)
+		if at == len(positions) || positions[at] != position+n+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// snippets returns the lines of the issue holding the text searched for,
+// looking in the comments only when the text was found there.
+func (q *Query) snippets(s storage.Storage, i issue.Issue, inComments bool) ([]string, error) {
+	terms := map[string]bool{}
+	for _, t := range q.text {
+		for _, term := range t.terms {
+			terms[term] = !t.negated || terms[term]
+		}
+	}
+	// the title is shown anyway
+	snippets := []string{}
+	if slices.Contains(q.scopes, "body") {
+		snippets = append(snippets, fulltext.Snippets(i.Body, terms, maxSnippets)...)
+	}
+	if !inComments || len(snippets) >= maxSnippets {
+		return snippets, nil
+	}
+	comments, err := s.Comments(i.Number)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		for _, line := range fulltext.Snippets(c.Body, terms, maxSnippets-len(snippets)) {
+			snippets = append(snippets, c.User.Login+": "+line)
+		}
+	}
+	return snippets, nil
+}
+
+// Merge joins the results of the search run on several stores, in the order
+// of the search. Results ordered by number are kept repo by repo.
+func (q *Query) Merge(results ...[]Result) []Result {
+	merged := []Result{}
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	var less func(a, b Result) bool
+	switch q.store.Sort {
+	case "", "number":
+		if q.store.Sort == "" && len(q.text) > 0 {
+			less = func(a, b Result) bool { return a.Score > b.Score }
+		}
+	case "created":
+		less = func(a, b Result) bool { return a.Issue.CreatedAt.Before(b.Issue.CreatedAt) }
+	case "updated":
+		less = func(a, b Result) bool { return a.Issue.UpdatedAt.Before(b.Issue.UpdatedAt) }
+	case "comments":
+		less = func(a, b Result) bool { return a.Issue.CommentCount < b.Issue.CommentCount }
+	case "reactions":
+		less = func(a, b Result) bool { return a.Issue.ReactionCount() < b.Issue.ReactionCount() }
+	}
+	if less == nil {
+		return merged
+	}
+	sort.SliceStable(merged, func(a, b int) bool {
+		if q.store.Desc {
+			return less(merged[b], merged[a])
+		}
+		return less(merged[a], merged[b])
+	})
+	return merged
+}
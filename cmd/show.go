@@ -5,13 +5,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/markdown"
+	"golang.org/x/term"
 )
 
 var raw bool
 var showComments bool
+var showDiff bool
+var showSince string
 
 // showCmd represents the show command
 var showCmd = &cobra.Command{
@@ -21,11 +27,29 @@ var showCmd = &cobra.Command{
 		if len(args) == 0 {
 			log.Fatal("You need to ask for one issue by number!")
 		}
+		since, err := parseDate("--since", showSince)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		if !since.IsZero() {
+			// only the conversation can be new
+			showComments = true
+		}
+		openStore()
 		issue, err := db.Get(args[0])
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(-1)
 		}
+		if showComments {
+			// comments are stored on their own, only load them when asked
+			issue.Comments, err = db.Comments(issue.Number)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(-1)
+			}
+		}
 		if raw {
 			b, err := json.MarshalIndent(issue, "", "  ")
 			if err != nil {
@@ -37,28 +61,108 @@ var showCmd = &cobra.Command{
 			fmt.Print(issue.FmtTitle())
 			fmt.Print(issue.FmtByLine())
 			if len(issue.Labels) > 0 {
-				fmt.Printf("\tLabels: %s\n", issue.Labels)
+				fmt.Printf("\tLabels: %s\n", issue.FmtLabels())
+			}
+			if issue.PullRequest != nil {
+				fmt.Print(issue.PullRequest.FmtPullRequest())
+			}
+			if issue.Body != "" && !issue.CreatedAt.Before(since) {
+				fmt.Println()
+				printMarkdown(issue.Body)
+			}
+			if showComments && issue.MissingComments() > 0 {
+				fmt.Printf("\nWarning: only %d of %d comments are stored, run \"ogi fetch\" to get the rest.\n", len(issue.Comments), issue.ExpectedComments())
+			}
+			if showComments {
+				showConversation(issue, since)
 			}
-			if issue.Body != nil {
-				fmt.Printf("\n%s\n", *issue.Body)
+			if showComments && issue.PullRequest != nil {
+				showReviewComments(issue.PullRequest, since)
 			}
-			if showComments && len(issue.Comments) > 0 {
-				fmt.Println("\n=== Comments ===")
-				for _, c := range issue.Comments {
-					if c.Body != nil {
-						fmt.Printf("\n=== %s at %s ===\n", *c.User.Login, c.CreatedAt.In(time.Local))
-						fmt.Println(*c.Body)
-					}
-				}
+			if showDiff && issue.PullRequest != nil {
+				fmt.Printf("\n=== Diff ===\n\n%s\n", issue.PullRequest.Diff)
 			}
 		}
 	},
 }
 
+// showReviewComments prints the line level review comments of a pull request
+// made since the given time, each with the end of the diff hunk it refers to.
+// The reviews themselves are part of the conversation.
+func showReviewComments(pr *issue.PullRequest, since time.Time) {
+	comments := []issue.ReviewComment{}
+	for _, c := range pr.ReviewComments {
+		if !c.CreatedAt.Before(since) {
+			comments = append(comments, c)
+		}
+	}
+	if len(comments) > 0 {
+		fmt.Println("\n=== Review Comments ===")
+		for _, c := range comments {
+			fmt.Printf("\n=== %s on %s at %s ===\n", c.User.Login, c.Path, c.CreatedAt.In(time.Local))
+			hunk := strings.Split(c.DiffHunk, "\n")
+			if len(hunk) > 4 {
+				hunk = hunk[len(hunk)-4:]
+			}
+			for _, line := range hunk {
+				fmt.Printf("  | %s\n", line)
+			}
+			printMarkdown(c.Body)
+		}
+	}
+}
+
+// printMarkdown prints the Markdown of a body rendered for the terminal, or
+// as it is when stdout isn't a terminal or colors are turned off.
+func printMarkdown(body string) {
+	width, ok := terminalWidth()
+	if !ok {
+		fmt.Println(body)
+		return
+	}
+	fmt.Println(markdown.Render(body, width))
+}
+
+// styled returns text drawn by style when output is rendered for a terminal,
+// and as it is otherwise.
+func styled(style func(string) string, text string) string {
+	if _, ok := terminalWidth(); !ok {
+		return text
+	}
+	return style(text)
+}
+
+// terminalWidth returns the width of the terminal stdout is, and whether
+// output is rendered for it: not when stdout isn't a terminal or colors are
+// turned off with --no-color or NO_COLOR.
+func terminalWidth() (int, bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return 0, false
+	}
+	return stdoutTerminal()
+}
+
+// stdoutTerminal returns the width of the terminal stdout is, 80 when it
+// can't be read, and whether stdout is a terminal. Tests replace it to
+// render as if on a terminal.
+var stdoutTerminal = func() (int, bool) {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0, false
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	return width, true
+}
+
 // init registers the show command with the root command and sets up flags on
 // the show command to display the raw JSON or append comments to the issue.
 func init() {
 	RootCmd.AddCommand(showCmd)
 	showCmd.Flags().BoolVarP(&raw, "raw", "r", false, "Show the raw JSON for this issue.")
 	showCmd.Flags().BoolVarP(&showComments, "comments", "c", false, "Append the comments to this issue.")
+	showCmd.Flags().BoolVarP(&showDiff, "diff", "d", false, "Append the diff of this pull request.")
+	showCmd.Flags().StringVar(&showSince, "since", "", "Only show the comments, reviews and events on or after this date.")
 }
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tommyshem/ogi/cmd/markdown"
+)
+
+// capture returns what f prints to stdout.
+func capture(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestNoColor(t *testing.T) {
+	stdout := stdoutTerminal
+	defer func() { stdoutTerminal = stdout }()
+	stdoutTerminal = func() (int, bool) { return 60, true }
+
+	body := "# Crash\n\nThe **app** crashes, see [the log](https://example.com/log).\n\n```\npanic: oops\n```"
+	rendered := markdown.Render(body, 60) + "\n"
+	if !strings.Contains(rendered, "\x1b[") {
+		t.Fatalf("Render(body, 60) = %q, want escape sequences", rendered)
+	}
+	tests := []struct {
+		name    string
+		noColor bool
+		env     string
+		want    string
+	}{
+		{"a terminal", false, "", rendered},
+		{"--no-color", true, "", body + "\n"},
+		{"NO_COLOR", false, "1", body + "\n"},
+		{"both", true, "1", body + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			noColor = tt.noColor
+			defer func() { noColor = false }()
+			t.Setenv("NO_COLOR", tt.env)
+
+			if got := capture(t, func() { printMarkdown(body) }); got != tt.want {
+				t.Errorf("printMarkdown printed %q, want %q", got, tt.want)
+			}
+			plain := tt.want != rendered
+			if got := styled(markdown.Bold, "alice"); (got == "alice") != plain {
+				t.Errorf("styled(Bold, alice) = %q, plain %t", got, plain)
+			}
+			if _, ok := terminalWidth(); ok == plain {
+				t.Errorf("terminalWidth renders %t, want %t", ok, !plain)
+			}
+		})
+	}
+
+	// stdout not being a terminal is plain as well
+	stdoutTerminal = func() (int, bool) { return 0, false }
+	if got := capture(t, func() { printMarkdown(body) }); got != body+"\n" {
+		t.Errorf("printMarkdown to a pipe printed %q, want the body as it is", got)
+	}
+}
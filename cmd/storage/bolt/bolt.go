@@ -1,23 +1,37 @@
 package bolt
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/boltdb/bolt" //TODO change to bbolt for updates as package
 	"github.com/mitchellh/go-homedir"
+	"github.com/tommyshem/ogi/cmd/fulltext"
 	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	// bbolt is the maintained fork of the archived github.com/boltdb/bolt,
+	// it uses the same file format so databases written before open as is.
+	bolt "go.etcd.io/bbolt"
 )
 
 type Store struct {
 	Owner  string
 	Repo   string
 	DBBolt *bolt.DB
+
+	// staging is set for a store returned by Stage, its issues are kept in
+	// the _staging bucket until Commit swaps them in.
+	staging bool
 }
 
+// BucketName returns the name of the repo's bucket, the GitHub owner and repo
+// names separated by a hyphen. As both may contain hyphens, owner a-b with
+// repo c and owner a with repo b-c share a name, the _info bucket records
+// which of them the bucket holds, see writeInfo.
 func (s Store) BucketName() []byte {
 	return []byte(fmt.Sprintf("%s-%s", s.Owner, s.Repo))
 }
@@ -28,25 +42,191 @@ func (s Store) BucketNameString() string {
 	return string(fmt.Sprintf("%s-%s", s.Owner, s.Repo))
 }
 
+// bucket layout
+//
+//	owner-repo bucket
+//	  _info bucket   owner, repo and last_updated of the stored repo
+//	  _map bucket       issue key -> issue state, see storage.IssueKey
+//	  _comments bucket  issue number and comment id -> comment json data,
+//	                    see storage.CommentKey
+//	  _index bucket     index key -> issue number, see storage.IndexKeys
+//	  _text bucket      full text index postings, see text.go
+//	  _textdocs bucket  full text index docs, see text.go
+//	  open bucket       issue key -> issue json data without comments
+//	  closed bucket     issue key -> issue json data without comments
+//
+//	_meta bucket     schema version, see schema.go
+//
+//	_staging bucket
+//	  owner-repo bucket  same layout, filled by a fetch before it is committed
+//	    _checkpoint      json Checkpoint of the fetch
+//
+// Top level buckets starting with an underscore are internal, GitHub owner
+// names can't start with one.
+var infoBucket = []byte("_info")
+var stagingBucket = []byte("_staging")
+var checkpointKey = []byte("_checkpoint")
+var commentsBucket = []byte("_comments")
+
+var _ storage.Storage = (*Store)(nil)
+
+// init registers the bolt backend.
+func init() {
+	storage.Register("bolt", storage.Backend{
+		OpenAt: func(location string) (storage.Storage, error) {
+			s, err := OpenAt(location)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		Location: Location,
+	})
+}
+
+// Open opens the BoltDB database without selecting a repository. Use ForRepo
+// to get a Store for one of the repositories it holds.
+func Open() (*Store, error) {
+	return OpenAt(Location())
+}
+
+// OpenAt opens the BoltDB database file at the given path without selecting
+// a repository.
+func OpenAt(path string) (*Store, error) {
+	s := &Store{}
+	// open the bolt database
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		slog.Info("New bolt db could not be opened filename :" + path)
+		return s, err
+	}
+	s.DBBolt = db
+	if err := s.upgrade(); err != nil {
+		db.Close()
+		return s, err
+	}
+	return s, nil
+}
+
 // New creates a new Store instance for the specified GitHub owner and repo.
 // It initializes a BoltDB database and creates a bucket for storing issues
 // if it does not already exist. Returns the initialized Store and any error
 // encountered during the database setup.
 func New(owner string, repo string) (*Store, error) {
-	s := &Store{Owner: owner, Repo: repo}
-	// open the bolt database
-	db, err := bolt.Open(Location(), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	s, err := Open()
 	if err != nil {
-		slog.Info("New bolt db could not be opened filename :" + Location())
 		return s, err
 	}
-	s.DBBolt = db
+	return s.forRepo(owner, repo)
+}
+
+// ForRepo returns a Store for the specified GitHub owner and repo sharing the
+// already opened database. The bucket for the repo is created if it does not
+// exist yet.
+func (s *Store) ForRepo(owner string, repo string) (storage.Storage, error) {
+	rs, err := s.forRepo(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Repository returns the owner and repo the store holds.
+func (s *Store) Repository() storage.Repo {
+	return storage.Repo{Owner: s.Owner, Repo: s.Repo}
+}
+
+// Close releases the database file.
+func (s *Store) Close() error {
+	return s.DBBolt.Close()
+}
+
+func (s *Store) forRepo(owner string, repo string) (*Store, error) {
+	rs := &Store{Owner: owner, Repo: repo, DBBolt: s.DBBolt}
 	// create bucket if it doesn't exist
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(s.BucketName())
+	err := rs.DBBolt.Update(func(tx *bolt.Tx) error {
+		pb, err := rs.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		return rs.writeInfo(pb)
+	})
+	return rs, err
+}
+
+// writeInfo records the owner and repo in the _info sub-bucket, as they
+// can't be recovered from the bucket name when either contains a hyphen. It
+// fails when the bucket already holds the issues of another repo with the
+// same bucket name, an empty bucket is taken over.
+func (s *Store) writeInfo(pb *bolt.Bucket) error {
+	ib, err := pb.CreateBucketIfNotExists(infoBucket)
+	if err != nil {
+		return err
+	}
+	owner, repo := ib.Get([]byte("owner")), ib.Get([]byte("repo"))
+	if owner != nil && (string(owner) != s.Owner || string(repo) != s.Repo) && hasIssues(pb) {
+		return fmt.Errorf("can't store %s/%s, its bucket %s already holds the issues of %s/%s", s.Owner, s.Repo, s.BucketName(), owner, repo)
+	}
+	if err := ib.Put([]byte("owner"), []byte(s.Owner)); err != nil {
 		return err
+	}
+	return ib.Put([]byte("repo"), []byte(s.Repo))
+}
+
+// hasIssues reports whether a repo bucket holds any issue.
+func hasIssues(pb *bolt.Bucket) bool {
+	inb := pb.Bucket([]byte("_map"))
+	if inb == nil {
+		return false
+	}
+	k, _ := inb.Cursor().First()
+	return k != nil
+}
+
+// SetLastUpdated records the time the repo was last synced with GitHub.
+func (s *Store) SetLastUpdated(t time.Time) error {
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		pb, err := s.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		if err := s.writeInfo(pb); err != nil {
+			return err
+		}
+		data, err := t.MarshalText()
+		if err != nil {
+			return err
+		}
+		return pb.Bucket(infoBucket).Put([]byte("last_updated"), data)
+	})
+}
+
+// Repos returns every repository stored in the database.
+func (s *Store) Repos() ([]storage.Repo, error) {
+	repos := []storage.Repo{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, pb *bolt.Bucket) error {
+			if strings.HasPrefix(string(name), "_") {
+				return nil
+			}
+			ib := pb.Bucket(infoBucket)
+			if ib == nil {
+				return nil
+			}
+			r := storage.Repo{
+				Owner: string(ib.Get([]byte("owner"))),
+				Repo:  string(ib.Get([]byte("repo"))),
+			}
+			if v := ib.Get([]byte("last_updated")); v != nil {
+				if err := r.LastUpdated.UnmarshalText(v); err != nil {
+					return err
+				}
+			}
+			repos = append(repos, r)
+			return nil
+		})
 	})
-	return s, err
+	return repos, err
 }
 
 // Clear deletes the entire bucket for the specified owner and repo,
@@ -54,59 +234,327 @@ func New(owner string, repo string) (*Store, error) {
 // bucket to ensure that the bucket is ready for new issues to be saved.
 func (s *Store) Clear() error {
 	return s.DBBolt.Update(func(tx *bolt.Tx) error {
-		tx.DeleteBucket(s.BucketName())
-		_, err := tx.CreateBucketIfNotExists(s.BucketName())
+		if err := s.deleteBucket(tx); err != nil {
+			return err
+		}
+		pb, err := s.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		return s.writeInfo(pb)
+	})
+}
+
+// Stage returns a Store writing to an empty staging copy of the repo's
+// bucket. The stored issues are left untouched until Commit swaps the staged
+// issues in, so a fetch that fails halfway keeps the previous snapshot.
+func (s *Store) Stage() (storage.Storage, error) {
+	st := &Store{Owner: s.Owner, Repo: s.Repo, DBBolt: s.DBBolt, staging: true}
+	if err := st.Clear(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Commit replaces the repo's issues with the staged ones and removes the
+// staging copy, all in one transaction. It can only be called on a Store
+// returned by Stage.
+func (s *Store) Commit() error {
+	if !s.staging {
+		return fmt.Errorf("%s/%s has no staged fetch to commit", s.Owner, s.Repo)
+	}
+	live := &Store{Owner: s.Owner, Repo: s.Repo, DBBolt: s.DBBolt}
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		sb := s.bucket(tx)
+		if sb == nil {
+			return fmt.Errorf("%s/%s has no staged fetch to commit", s.Owner, s.Repo)
+		}
+		if err := live.deleteBucket(tx); err != nil {
+			return err
+		}
+		lb, err := live.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(lb, sb); err != nil {
+			return err
+		}
+		if err := lb.Delete(checkpointKey); err != nil {
+			return err
+		}
+		return s.deleteBucket(tx)
+	})
+}
+
+// Resume returns a Store for the repo's staged fetch together with its
+// checkpoint. It fails when there is no staged fetch to resume.
+func (s *Store) Resume() (storage.Storage, *storage.Checkpoint, error) {
+	st := &Store{Owner: s.Owner, Repo: s.Repo, DBBolt: s.DBBolt, staging: true}
+	c := &storage.Checkpoint{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		sb := st.bucket(tx)
+		if sb == nil || sb.Get(checkpointKey) == nil {
+			return fmt.Errorf("%s/%s has no interrupted fetch to resume", s.Owner, s.Repo)
+		}
+		return json.Unmarshal(sb.Get(checkpointKey), c)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, c, nil
+}
+
+// SaveCheckpoint records the progress of a staged fetch.
+func (s *Store) SaveCheckpoint(c storage.Checkpoint) error {
+	if !s.staging {
+		return fmt.Errorf("%s/%s has no staged fetch to checkpoint", s.Owner, s.Repo)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
 		return err
+	}
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		pb, err := s.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		return pb.Put(checkpointKey, data)
+	})
+}
+
+// Has reports whether the issue with the specified number is stored.
+func (s *Store) Has(number int) (bool, error) {
+	found := false
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		if inb := pb.Bucket([]byte("_map")); inb != nil {
+			found = inb.Get(storage.IssueKey(number)) != nil
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Count returns the number of issues stored.
+func (s *Store) Count() (int, error) {
+	count := 0
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		if inb := pb.Bucket([]byte("_map")); inb != nil {
+			count = inb.Stats().KeyN
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Discard removes the staged issues, leaving the stored ones untouched.
+func (s *Store) Discard() error {
+	if !s.staging {
+		return fmt.Errorf("%s/%s has no staged fetch to discard", s.Owner, s.Repo)
+	}
+	return s.DBBolt.Update(s.deleteBucket)
+}
+
+// bucket returns the repo's bucket, or nil when it doesn't exist.
+func (s *Store) bucket(tx *bolt.Tx) *bolt.Bucket {
+	if s.staging {
+		sb := tx.Bucket(stagingBucket)
+		if sb == nil {
+			return nil
+		}
+		return sb.Bucket(s.BucketName())
+	}
+	return tx.Bucket(s.BucketName())
+}
+
+// createBucket returns the repo's bucket, creating it when needed.
+func (s *Store) createBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	if s.staging {
+		sb, err := tx.CreateBucketIfNotExists(stagingBucket)
+		if err != nil {
+			return nil, err
+		}
+		return sb.CreateBucketIfNotExists(s.BucketName())
+	}
+	return tx.CreateBucketIfNotExists(s.BucketName())
+}
+
+// deleteBucket deletes the repo's bucket if it exists.
+func (s *Store) deleteBucket(tx *bolt.Tx) error {
+	var err error
+	if s.staging {
+		sb := tx.Bucket(stagingBucket)
+		if sb == nil {
+			return nil
+		}
+		err = sb.DeleteBucket(s.BucketName())
+	} else {
+		err = tx.DeleteBucket(s.BucketName())
+	}
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+// copyBucket copies every key and nested bucket of src into dst.
+func copyBucket(dst *bolt.Bucket, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
 	})
 }
 
 // Save persists the given issue to the local database. It uses a BoltDB bucket
-// created from the owner and repo name, and creates two sub-buckets: one for
-// the issue data itself, and another for a lookup table mapping issue numbers
-// to their respective states.
+// created from the owner and repo name, and creates sub-buckets: one for the
+// issue data itself, one for its comments, and another for a lookup table
+// mapping issue numbers to their respective states. When the state of the
+// issue changed, the copy stored under the old state is removed in the same
+// transaction, so the issue is never listed twice.
 func (s *Store) Save(is issue.Issue) error {
+	id := storage.IssueKey(is.Number)
 
-	return s.DBBolt.Update(func(tx *bolt.Tx) error {
-
-		pb, _ := tx.CreateBucketIfNotExists(s.BucketName())
+	comments, err := marshalComments(is.Number, is.Comments)
+	if err != nil {
+		return err
+	}
+	doc := fulltext.Analyze(is)
+	is.Version = issue.FormatVersion
+	is.Comments = nil
+	data, err := json.Marshal(is)
+	if err != nil {
+		return err
+	}
 
-		b, _ := pb.CreateBucketIfNotExists([]byte(*is.State))
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		pb, err := s.createBucket(tx)
+		if err != nil {
+			return err
+		}
+		if err := updateIndex(pb, id, &is); err != nil {
+			return err
+		}
+		if err := updateText(pb, is.Number, &doc); err != nil {
+			return err
+		}
+		if err := removeIssue(pb, id, is.State); err != nil {
+			return err
+		}
 
-		//data
-		data, err := json.Marshal(is)
+		b, err := pb.CreateBucketIfNotExists([]byte(is.State))
 		if err != nil {
 			return err
 		}
-		//
-		err = b.Put([]byte(strconv.Itoa(*is.Number)), data)
+		if err := b.Put(id, data); err != nil {
+			return err
+		}
+		if err := putComments(pb, is.Number, comments); err != nil {
+			return err
+		}
+
+		inb, err := pb.CreateBucketIfNotExists([]byte("_map"))
 		if err != nil {
 			return err
 		}
+		return inb.Put(id, []byte(is.State))
+	})
+}
 
-		inb, _ := pb.CreateBucketIfNotExists([]byte("_map"))
+// Delete removes the issue with the specified number from the local database,
+// for issues that were deleted or transferred to another repo on GitHub.
+func (s *Store) Delete(number int) error {
+	id := storage.IssueKey(number)
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return fmt.Errorf("issue #%d was not found!", number)
+		}
+		inb := pb.Bucket([]byte("_map"))
+		if inb == nil || inb.Get(id) == nil {
+			return fmt.Errorf("issue #%d was not found!", number)
+		}
+		if err := updateIndex(pb, id, nil); err != nil {
+			return err
+		}
+		if err := updateText(pb, number, nil); err != nil {
+			return err
+		}
+		if err := removeIssue(pb, id, ""); err != nil {
+			return err
+		}
+		if err := putComments(pb, number, nil); err != nil {
+			return err
+		}
+		return inb.Delete(id)
+	})
+}
 
-		return inb.Put([]byte(strconv.Itoa(*is.Number)), []byte(*is.State))
+// removeIssue deletes the copies of an issue from every state bucket except
+// the keep one. The state recorded in _map is checked first, the other state
+// buckets are checked too as older versions could leave stale copies behind.
+func removeIssue(pb *bolt.Bucket, id []byte, keep string) error {
+	states := [][]byte{}
+	if inb := pb.Bucket([]byte("_map")); inb != nil {
+		if old := inb.Get(id); old != nil {
+			states = append(states, append([]byte{}, old...))
+		}
+	}
+	err := pb.ForEach(func(name, v []byte) error {
+		if v == nil && !strings.HasPrefix(string(name), "_") {
+			states = append(states, append([]byte{}, name...))
+		}
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if string(state) == keep {
+			continue
+		}
+		if b := pb.Bucket(state); b != nil {
+			if err := b.Delete(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // Get retrieves the issue with the specified number from the local database.
-// It returns the issue with all associated comments and any error encountered
-// during the retrieval process.
+// It returns the issue without its comments, use Comments to load them.
 func (s *Store) Get(number string) (issue.Issue, error) {
 
-	id := []byte(number)
-
 	i := issue.Issue{}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return i, fmt.Errorf("issue #%s was not found!", number)
+	}
+	id := storage.IssueKey(n)
 
-	err := s.DBBolt.View(func(tx *bolt.Tx) error {
-
-		pb := tx.Bucket(s.BucketName())
-
-		inb := pb.Bucket([]byte("_map"))
-		bn := inb.Get(id)
+	err = s.DBBolt.View(func(tx *bolt.Tx) error {
 
-		b := pb.Bucket(bn)
-		v := b.Get(id)
+		var v []byte
+		if pb := s.bucket(tx); pb != nil {
+			if inb := pb.Bucket([]byte("_map")); inb != nil {
+				if b := pb.Bucket(inb.Get(id)); b != nil {
+					v = b.Get(id)
+				}
+			}
+		}
 
 		if v == nil {
 			return fmt.Errorf("issue #%s was not found!", number)
@@ -119,32 +567,26 @@ func (s *Store) Get(number string) (issue.Issue, error) {
 }
 
 // All retrieves all of the issues for the specified owner and repo from the
-// local database. It returns all issues with all associated comments and any
-// error encountered during the retrieval process.
+// local database, without their comments.
 func (s *Store) All() ([]issue.Issue, error) {
 	issues := []issue.Issue{}
-
-	err := s.DBBolt.View(func(tx *bolt.Tx) error {
-		for _, state := range []string{"open", "closed"} {
-			si, err := s.AllByState(state)
-			if err != nil {
-				return err
-			}
-			issues = append(issues, si...)
-		}
+	err := s.Each("all", false, func(i issue.Issue) error {
+		issues = append(issues, i)
 		return nil
 	})
 	return issues, err
 }
 
 // AllByState retrieves all of the issues for the specified owner and repo with
-// the specified state from the local database. It returns all issues with all
-// associated comments and any error encountered during the retrieval process.
+// the specified state from the local database, without their comments.
 func (s *Store) AllByState(state string) ([]issue.Issue, error) {
 	issues := []issue.Issue{}
 
-	s.DBBolt.View(func(tx *bolt.Tx) error {
-		pb := tx.Bucket(s.BucketName())
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
 		b := pb.Bucket([]byte(state))
 		if b == nil {
 			// the bucket doesn't exist, possibly because there are no
@@ -161,7 +603,120 @@ func (s *Store) AllByState(state string) ([]issue.Issue, error) {
 			return nil
 		})
 	})
-	return issues, nil
+	return issues, err
+}
+
+// Each calls fn with the issues of a state, open, closed or all, one at a
+// time, all in one read transaction.
+func (s *Store) Each(state string, withComments bool, fn func(i issue.Issue) error) error {
+	states := []string{"open", "closed"}
+	if state == "open" || state == "closed" {
+		states = []string{state}
+	}
+	return s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		for _, state := range states {
+			b := pb.Bucket([]byte(state))
+			if b == nil {
+				continue
+			}
+			err := b.ForEach(func(k, v []byte) error {
+				i := issue.Issue{}
+				if err := json.Unmarshal(v, &i); err != nil {
+					return err
+				}
+				if withComments {
+					comments, err := storedComments(pb, i.Number)
+					if err != nil {
+						return err
+					}
+					i.Comments = comments
+				}
+				return fn(i)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Comments returns the stored comments of the issue with the specified
+// number, oldest first.
+func (s *Store) Comments(number int) ([]issue.Comment, error) {
+	comments := []issue.Comment{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		var err error
+		comments, err = storedComments(pb, number)
+		return err
+	})
+	return comments, err
+}
+
+// storedComments reads the comments of an issue from the repo bucket.
+func storedComments(pb *bolt.Bucket, number int) ([]issue.Comment, error) {
+	comments := []issue.Comment{}
+	cb := pb.Bucket(commentsBucket)
+	if cb == nil {
+		return comments, nil
+	}
+	prefix := storage.CommentPrefix(number)
+	c := cb.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		comment := issue.Comment{}
+		if err := json.Unmarshal(v, &comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// marshalComments returns the comments of an issue keyed as they are stored.
+func marshalComments(number int, comments []issue.Comment) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	for _, c := range comments {
+		v, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		data[string(storage.CommentKey(number, c.ID))] = v
+	}
+	return data, nil
+}
+
+// putComments replaces the stored comments of an issue.
+func putComments(pb *bolt.Bucket, number int, comments map[string][]byte) error {
+	cb, err := pb.CreateBucketIfNotExists(commentsBucket)
+	if err != nil {
+		return err
+	}
+	prefix := storage.CommentPrefix(number)
+	// collect first, deleting while moving the cursor skips keys
+	old := [][]byte{}
+	c := cb.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		old = append(old, append([]byte{}, k...))
+	}
+	for _, k := range old {
+		if err := cb.Delete(k); err != nil {
+			return err
+		}
+	}
+	for k, v := range comments {
+		if err := cb.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Location returns the path to the Bolt database file.
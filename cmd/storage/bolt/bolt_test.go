@@ -0,0 +1,318 @@
+package bolt
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/conformance"
+	"github.com/tommyshem/ogi/cmd/storage/storagetest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(dir string) (storage.Storage, error) {
+		return OpenAt(filepath.Join(dir, "issues.db"))
+	})
+}
+
+// TestUpgrade checks a database written before schema versions were recorded
+// is upgraded to the current layout when it is opened.
+func TestUpgrade(t *testing.T) {
+	issues, err := storagetest.LegacyIssues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "issues.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		pb, err := tx.CreateBucket([]byte("octo-hello"))
+		if err != nil {
+			return err
+		}
+		mb, err := pb.CreateBucket([]byte("_map"))
+		if err != nil {
+			return err
+		}
+		for _, i := range issues {
+			b, err := pb.CreateBucketIfNotExists([]byte(i.State))
+			if err != nil {
+				return err
+			}
+			key := []byte(strconv.Itoa(i.Number))
+			if err := b.Put(key, i.Issue); err != nil {
+				return err
+			}
+			if err := mb.Put(key, []byte(i.State)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	for _, err := range conformance.CheckUpgraded(root) {
+		t.Error(err)
+	}
+}
+
+// TestUpgradeRepoInfo checks the owner and repo of a bucket written before
+// they were recorded are read from its issues, the bucket name only being
+// split on its first hyphen when it holds none.
+func TestUpgradeRepoInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issues.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := map[string]string{
+		"my-org-hello-world": `{"number":1,"state":"open","title":"api url","repository_url":"https://api.github.com/repos/my-org/hello-world"}`,
+		"big-co-tools":       `{"number":1,"state":"open","title":"enterprise","repository_url":"https://git.example.com/api/v3/repos/big-co/tools"}`,
+		"a-b-c":              `{"number":1,"state":"open","title":"html url","html_url":"https://github.com/a/b-c/issues/1"}`,
+		"octo-empty-repo":    "",
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name, data := range buckets {
+			pb, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if data == "" {
+				continue
+			}
+			b, err := pb.CreateBucket([]byte("open"))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("1"), []byte(data)); err != nil {
+				return err
+			}
+			mb, err := pb.CreateBucket([]byte("_map"))
+			if err != nil {
+				return err
+			}
+			if err := mb.Put([]byte("1"), []byte("open")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	repos, err := root.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range repos {
+		got = append(got, r.Owner+"/"+r.Repo)
+	}
+	slices.Sort(got)
+	want := []string{"a/b-c", "big-co/tools", "my-org/hello-world", "octo/empty-repo"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Repos = %v, want %v", got, want)
+	}
+	for _, r := range repos {
+		s, err := root.ForRepo(r.Owner, r.Repo)
+		if err != nil {
+			t.Errorf("ForRepo %s/%s: %s", r.Owner, r.Repo, err)
+			continue
+		}
+		want := 1
+		if r.Repo == "empty-repo" {
+			want = 0
+		}
+		if n, err := s.Count(); err != nil || n != want {
+			t.Errorf("%s/%s holds %d issues (%v), want %d", r.Owner, r.Repo, n, err, want)
+		}
+	}
+}
+
+// TestBucketNameClash checks a repo is refused the bucket of another repo
+// whose owner and repo names join to the same bucket name, unless the other
+// repo has no issues.
+func TestBucketNameClash(t *testing.T) {
+	root, err := OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	if _, err := root.ForRepo("a", "b-c"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := root.ForRepo("a-b", "c")
+	if err != nil {
+		t.Fatalf("ForRepo a-b/c of an empty bucket: %s", err)
+	}
+	if err := first.Save(issue.Issue{Number: 1, State: "open", Title: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.ForRepo("a", "b-c"); err == nil {
+		t.Errorf("ForRepo a/b-c succeeded, though its bucket holds the issues of a-b/c")
+	}
+	if err := first.SetLastUpdated(time.Now()); err != nil {
+		t.Errorf("SetLastUpdated of the bucket's own repo: %s", err)
+	}
+	repos, err := root.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Owner != "a-b" || repos[0].Repo != "c" {
+		t.Errorf("Repos = %+v, want a-b/c", repos)
+	}
+}
+
+// TestStateMove checks saving an issue in another state moves it between the
+// state sub-buckets and records its new state in _map.
+func TestStateMove(t *testing.T) {
+	root, err := OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	s, err := root.forRepo("octo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check compares the issue numbers of the state sub-buckets and the
+	// states _map records with the wanted ones.
+	check := func(step string, want map[string][]int) {
+		t.Helper()
+		err := s.DBBolt.View(func(tx *bolt.Tx) error {
+			pb := s.bucket(tx)
+			mapped := map[int]string{}
+			err := pb.Bucket([]byte("_map")).ForEach(func(k, v []byte) error {
+				mapped[storage.IssueNumber(k)] = string(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			wantMapped := map[int]string{}
+			for _, state := range []string{"open", "closed"} {
+				got := []int{}
+				if b := pb.Bucket([]byte(state)); b != nil {
+					err := b.ForEach(func(k, _ []byte) error {
+						got = append(got, storage.IssueNumber(k))
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if !slices.Equal(got, want[state]) {
+					t.Errorf("%s: the %s bucket holds %v, want %v", step, state, got, want[state])
+				}
+				for _, n := range want[state] {
+					wantMapped[n] = state
+				}
+			}
+			if !maps.Equal(mapped, wantMapped) {
+				t.Errorf("%s: _map = %v, want %v", step, mapped, wantMapped)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save := func(number int, state string) {
+		t.Helper()
+		is := issue.Issue{Number: number, State: state, Title: "Crash on start", Comments: []issue.Comment{{ID: int64(number), Body: "again"}}}
+		if err := s.Save(is); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(1, "open")
+	save(2, "open")
+	save(3, "closed")
+	check("saved", map[string][]int{"open": {1, 2}, "closed": {3}})
+
+	save(1, "closed")
+	check("closed #1", map[string][]int{"open": {2}, "closed": {1, 3}})
+	if is, err := s.Get("1"); err != nil || is.State != "closed" {
+		t.Errorf("Get(1) = %s, %v, want it closed", is.State, err)
+	}
+	if comments, err := s.Comments(1); err != nil || len(comments) != 1 {
+		t.Errorf("Comments(1) = %v, %v, want the comment kept", comments, err)
+	}
+	if q, err := s.Query(storage.Query{State: "open"}); err != nil || len(q) != 1 || q[0].Number != 2 {
+		t.Errorf("Query of the open issues = %v, %v, want #2", q, err)
+	}
+
+	save(3, "open")
+	check("reopened #3", map[string][]int{"open": {2, 3}, "closed": {1}})
+
+	if err := s.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	check("deleted #2", map[string][]int{"open": {3}, "closed": {1}})
+}
+
+// TestReadErrors checks an issue that can't be decoded fails the reads
+// instead of being left out.
+func TestReadErrors(t *testing.T) {
+	root, err := OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	s, err := root.forRepo("octo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []issue.Issue{{Number: 1, State: "open"}, {Number: 2, State: "closed"}} {
+		if err := s.Save(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if all, err := s.All(); err != nil || len(all) != 2 || all[0].Number != 1 || all[1].Number != 2 {
+		t.Fatalf("All = %v, %v, want #1 then #2", all, err)
+	}
+	err = s.DBBolt.Update(func(tx *bolt.Tx) error {
+		return s.bucket(tx).Bucket([]byte("closed")).Put(storage.IssueKey(2), []byte("{not json"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AllByState("closed"); err == nil {
+		t.Errorf("AllByState(closed) succeeded with a broken issue")
+	}
+	if _, err := s.All(); err == nil {
+		t.Errorf("All succeeded with a broken issue")
+	}
+	if open, err := s.AllByState("open"); err != nil || len(open) != 1 {
+		t.Errorf("AllByState(open) = %v, %v, want #1", open, err)
+	}
+}
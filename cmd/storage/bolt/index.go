@@ -0,0 +1,127 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// _index bucket, in the repo bucket
+//
+//	index key -> issue number, see storage.IndexKeys
+var indexBucket = []byte("_index")
+
+// Query returns the issues matching q, without their comments, in the order
+// it asks for. The indexed fields and the order are looked up in the _index
+// bucket, only the issues returned are decoded.
+func (s *Store) Query(q storage.Query) ([]issue.Issue, error) {
+	issues := []issue.Issue{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		numbers := func(state string) ([]int, error) {
+			found := []int{}
+			b := pb.Bucket([]byte("_map"))
+			if state != "" {
+				b = pb.Bucket([]byte(state))
+			}
+			if b == nil {
+				return found, nil
+			}
+			err := b.ForEach(func(k []byte, v []byte) error {
+				found = append(found, storage.IssueNumber(k))
+				return nil
+			})
+			return found, err
+		}
+		scan := func(start []byte, end []byte) ([][]byte, error) {
+			values := [][]byte{}
+			ib := pb.Bucket(indexBucket)
+			if ib == nil {
+				return values, nil
+			}
+			c := ib.Cursor()
+			for k, v := c.Seek(start); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+				values = append(values, v)
+			}
+			return values, nil
+		}
+		get := func(number int) (*issue.Issue, error) {
+			return storedIssue(pb, storage.IssueKey(number))
+		}
+		var err error
+		issues, err = q.Run(numbers, scan, get)
+		return err
+	})
+	return issues, err
+}
+
+// storedIssue returns the issue stored in the repo bucket under id, or nil
+// when there is none.
+func storedIssue(pb *bolt.Bucket, id []byte) (*issue.Issue, error) {
+	inb := pb.Bucket([]byte("_map"))
+	if inb == nil {
+		return nil, nil
+	}
+	state := inb.Get(id)
+	if state == nil {
+		return nil, nil
+	}
+	b := pb.Bucket(state)
+	if b == nil {
+		return nil, nil
+	}
+	v := b.Get(id)
+	if v == nil {
+		return nil, nil
+	}
+	i := issue.Issue{}
+	if err := json.Unmarshal(v, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// updateIndex replaces the index keys of the issue stored under id with those
+// of the is issue, or removes them when is is nil. It must be called before
+// the stored issue is replaced or removed.
+func updateIndex(pb *bolt.Bucket, id []byte, is *issue.Issue) error {
+	ib, err := pb.CreateBucketIfNotExists(indexBucket)
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	if is != nil {
+		for _, k := range storage.IndexKeys(*is) {
+			keep[string(k)] = true
+		}
+	}
+	old, err := storedIssue(pb, id)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		for _, k := range storage.IndexKeys(*old) {
+			if !keep[string(k)] {
+				if err := ib.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if is == nil {
+		return nil
+	}
+	value := storage.IndexValue(is.Number)
+	for k := range keep {
+		if err := ib.Put([]byte(k), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// _meta bucket
+//
+//	schema_version  storage.SchemaVersion of the layout
+//	ogi_version     version of ogi that created or last upgraded the file
+var metaBucket = []byte("_meta")
+var schemaVersionKey = []byte("schema_version")
+var ogiVersionKey = []byte("ogi_version")
+
+// migrations upgrade a database to the schema version they are keyed by,
+// from the version before. They all run in the transaction that records the
+// new version, so a failed upgrade leaves the file as it was. They write the
+// keys of their own version with the frozen copies of the storage package,
+// like storage.IndexKeysV4, never with the live encodings.
+var migrations = map[int]func(tx *bolt.Tx) error{
+	1: addRepoInfo,
+	2: convertIssues,
+	3: splitComments,
+	4: buildIndexesV4,
+	5: buildTextIndex,
+	6: rekeyIssues,
+}
+
+// upgrade runs the migrations a database written by an older ogi needs. A
+// new database is stamped with the current schema version, a database newer
+// than this build fails with a storage.SchemaError.
+func (s *Store) upgrade() error {
+	meta, err := s.Meta()
+	if err != nil || meta.SchemaVersion == storage.SchemaVersion {
+		return err
+	}
+	if meta.SchemaVersion > storage.SchemaVersion {
+		return &storage.SchemaError{Location: s.DBBolt.Path(), Version: meta.SchemaVersion, OgiVersion: meta.OgiVersion}
+	}
+	return s.DBBolt.Update(func(tx *bolt.Tx) error {
+		version := meta.SchemaVersion
+		if tx.Bucket(metaBucket) == nil && isEmpty(tx) {
+			// nothing to upgrade in a new database
+			version = storage.SchemaVersion
+		}
+		for v := version + 1; v <= storage.SchemaVersion; v++ {
+			if migrate, ok := migrations[v]; ok {
+				if err := migrate(tx); err != nil {
+					return &storage.MigrationError{Location: s.DBBolt.Path(), Version: v, Err: err}
+				}
+			}
+		}
+		mb, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := mb.Put(schemaVersionKey, []byte(strconv.Itoa(storage.SchemaVersion))); err != nil {
+			return err
+		}
+		return mb.Put(ogiVersionKey, []byte(storage.AppVersion))
+	})
+}
+
+// Meta returns the schema version of the database and the ogi version that
+// created or last upgraded it. Files written before the _meta bucket existed
+// are at schema version 0.
+func (s *Store) Meta() (storage.Meta, error) {
+	meta := storage.Meta{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		mb := tx.Bucket(metaBucket)
+		if mb == nil {
+			return nil
+		}
+		meta.OgiVersion = string(mb.Get(ogiVersionKey))
+		version, err := strconv.Atoi(string(mb.Get(schemaVersionKey)))
+		meta.SchemaVersion = version
+		return err
+	})
+	return meta, err
+}
+
+// isEmpty reports whether the database holds no bucket at all.
+func isEmpty(tx *bolt.Tx) bool {
+	name, _ := tx.Cursor().First()
+	return name == nil
+}
+
+// forEachRepoBucket calls fn with the bucket of every stored repo, the live
+// ones and those of staged fetches.
+func forEachRepoBucket(tx *bolt.Tx, fn func(name []byte, pb *bolt.Bucket) error) error {
+	err := tx.ForEach(func(name []byte, pb *bolt.Bucket) error {
+		if strings.HasPrefix(string(name), "_") {
+			return nil
+		}
+		return fn(name, pb)
+	})
+	if err != nil {
+		return err
+	}
+	staging := tx.Bucket(stagingBucket)
+	if staging == nil {
+		return nil
+	}
+	return staging.ForEach(func(name []byte, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		return fn(name, staging.Bucket(name))
+	})
+}
+
+// addRepoInfo records the owner and repo of the buckets written before the
+// _info bucket existed. The bucket name joins them with a hyphen, which both
+// may contain, so they are read from the URLs of a stored issue, and only
+// guessed by splitting the name on its first hyphen for a bucket without
+// issues.
+func addRepoInfo(tx *bolt.Tx) error {
+	return forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		if pb.Bucket(infoBucket) != nil {
+			return nil
+		}
+		owner, repo, err := storedRepo(name, pb)
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			parts := strings.SplitN(string(name), "-", 2)
+			if len(parts) != 2 {
+				return nil
+			}
+			owner, repo = parts[0], parts[1]
+		}
+		ib, err := pb.CreateBucketIfNotExists(infoBucket)
+		if err != nil {
+			return err
+		}
+		if err := ib.Put([]byte("owner"), []byte(owner)); err != nil {
+			return err
+		}
+		return ib.Put([]byte("repo"), []byte(repo))
+	})
+}
+
+// storedRepo returns the owner and repo of the first issue of a bucket
+// holding issues in the go-github format, read from its repository_url or
+// html_url. They are empty when the bucket holds no issue or its URLs don't
+// name a repo matching the bucket name.
+func storedRepo(name []byte, pb *bolt.Bucket) (string, string, error) {
+	var urls struct {
+		RepositoryURL string `json:"repository_url"`
+		HTMLURL       string `json:"html_url"`
+	}
+	found := false
+	err := pb.ForEach(func(state []byte, v []byte) error {
+		if found || v != nil || strings.HasPrefix(string(state), "_") {
+			return nil
+		}
+		_, data := pb.Bucket(state).Cursor().First()
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &urls)
+	})
+	if err != nil || !found {
+		return "", "", err
+	}
+	candidates := [][2]string{}
+	// https://api.github.com/repos/owner/repo, or /api/v3/repos/owner/repo
+	// on GitHub Enterprise
+	if _, path, ok := strings.Cut(urls.RepositoryURL, "/repos/"); ok {
+		if parts := strings.Split(path, "/"); len(parts) >= 2 {
+			candidates = append(candidates, [2]string{parts[0], parts[1]})
+		}
+	}
+	// https://github.com/owner/repo/issues/1
+	if _, path, ok := strings.Cut(urls.HTMLURL, "://"); ok {
+		if parts := strings.Split(path, "/"); len(parts) >= 3 {
+			candidates = append(candidates, [2]string{parts[1], parts[2]})
+		}
+	}
+	for _, c := range candidates {
+		if c[0]+"-"+c[1] == string(name) {
+			return c[0], c[1], nil
+		}
+	}
+	return "", "", nil
+}
+
+// convertIssues rewrites the issues stored in the go-github format in ogi's
+// own issue format.
+func convertIssues(tx *bolt.Tx) error {
+	return forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		return pb.ForEach(func(state []byte, v []byte) error {
+			if v != nil || strings.HasPrefix(string(state), "_") {
+				return nil
+			}
+			b := pb.Bucket(state)
+			// collect first, a bucket can't be changed while iterating it
+			converted := map[string][]byte{}
+			err := b.ForEach(func(k []byte, v []byte) error {
+				if !issue.IsLegacy(v) {
+					return nil
+				}
+				i, err := issue.FromLegacy(v)
+				if err != nil {
+					return err
+				}
+				data, err := json.Marshal(i)
+				if err != nil {
+					return err
+				}
+				converted[string(k)] = data
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k, data := range converted {
+				if err := b.Put([]byte(k), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// splitComments moves the comments stored with each issue to the _comments
+// bucket.
+func splitComments(tx *bolt.Tx) error {
+	return forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		states := [][]byte{}
+		err := pb.ForEach(func(state []byte, v []byte) error {
+			if v == nil && !strings.HasPrefix(string(state), "_") {
+				states = append(states, append([]byte{}, state...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			b := pb.Bucket(state)
+			issues := map[string]issue.Issue{}
+			err := b.ForEach(func(k []byte, v []byte) error {
+				i := issue.Issue{}
+				if err := json.Unmarshal(v, &i); err != nil {
+					return err
+				}
+				if len(i.Comments) > 0 {
+					issues[string(k)] = i
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			cb, err := pb.CreateBucketIfNotExists(commentsBucket)
+			if err != nil {
+				return err
+			}
+			for k, i := range issues {
+				for _, c := range i.Comments {
+					data, err := json.Marshal(c)
+					if err != nil {
+						return err
+					}
+					if err := cb.Put(storage.CommentKeyV3(i.Number, c.ID), data); err != nil {
+						return err
+					}
+				}
+				i.Comments = nil
+				data, err := json.Marshal(i)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte(k), data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// buildIndexesV4 adds the index keys of every stored issue to the _index
+// bucket.
+func buildIndexesV4(tx *bolt.Tx) error {
+	return buildIndexes(tx, storage.IndexKeysV4)
+}
+
+// buildIndexes adds the index keys of every stored issue returned by
+// indexKeys to the _index bucket.
+func buildIndexes(tx *bolt.Tx, indexKeys func(i issue.Issue) [][]byte) error {
+	return forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		ib, err := pb.CreateBucketIfNotExists(indexBucket)
+		if err != nil {
+			return err
+		}
+		return pb.ForEach(func(state []byte, v []byte) error {
+			if v != nil || strings.HasPrefix(string(state), "_") {
+				return nil
+			}
+			return pb.Bucket(state).ForEach(func(k []byte, v []byte) error {
+				i := issue.Issue{}
+				if err := json.Unmarshal(v, &i); err != nil {
+					return err
+				}
+				for _, key := range indexKeys(i) {
+					if err := ib.Put(key, storage.IndexValueV4(i.Number)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	})
+}
+
+// buildTextIndex adds the title, body and comments of every stored issue to
+// the full text index.
+func buildTextIndex(tx *bolt.Tx) error {
+	return forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		issues := []issue.Issue{}
+		err := pb.ForEach(func(state []byte, v []byte) error {
+			if v != nil || strings.HasPrefix(string(state), "_") {
+				return nil
+			}
+			return pb.Bucket(state).ForEach(func(k []byte, v []byte) error {
+				i := issue.Issue{}
+				if err := json.Unmarshal(v, &i); err != nil {
+					return err
+				}
+				issues = append(issues, i)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		tb, err := pb.CreateBucketIfNotExists(textBucket)
+		if err != nil {
+			return err
+		}
+		db, err := pb.CreateBucketIfNotExists(textDocsBucket)
+		if err != nil {
+			return err
+		}
+		cb := pb.Bucket(commentsBucket)
+		for _, i := range issues {
+			if cb != nil {
+				prefix := storage.CommentPrefixV3(i.Number)
+				c := cb.Cursor()
+				for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+					comment := issue.Comment{}
+					if err := json.Unmarshal(v, &comment); err != nil {
+						return err
+					}
+					i.Comments = append(i.Comments, comment)
+				}
+			}
+			doc := fulltext.Analyze(i)
+			for k, v := range storage.TextEntriesV5(doc) {
+				if err := tb.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+			if err := db.Put(storage.TextDocKeyV5(i.Number), storage.EncodeTextDocV5(doc)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rekeyIssues moves the issues and their states from keys holding their
+// number in decimal to 8 byte big endian, then adds the index keys ordering
+// them by creation time, comments and reactions.
+func rekeyIssues(tx *bolt.Tx) error {
+	err := forEachRepoBucket(tx, func(name []byte, pb *bolt.Bucket) error {
+		return pb.ForEach(func(bucket []byte, v []byte) error {
+			if v != nil || strings.HasPrefix(string(bucket), "_") && string(bucket) != "_map" {
+				return nil
+			}
+			b := pb.Bucket(bucket)
+			// collect first, a bucket can't be changed while iterating it
+			moved := map[string][]byte{}
+			err := b.ForEach(func(k []byte, v []byte) error {
+				if _, err := strconv.Atoi(string(k)); err == nil {
+					moved[string(k)] = append([]byte{}, v...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k, v := range moved {
+				n, _ := strconv.Atoi(k)
+				if err := b.Delete([]byte(k)); err != nil {
+					return err
+				}
+				if err := b.Put(storage.IssueKeyV6(n), v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return buildIndexes(tx, storage.IndexKeysV6)
+}
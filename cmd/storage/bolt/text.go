@@ -0,0 +1,107 @@
+package bolt
+
+import (
+	"bytes"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// _text and _textdocs buckets, in the repo bucket
+//
+//	term and issue number -> posting, see storage.TextEntries
+//	issue number -> text doc, see storage.EncodeTextDoc
+var textBucket = []byte("_text")
+var textDocsBucket = []byte("_textdocs")
+
+// Postings returns the issues a term is found in, ordered by number.
+func (s *Store) Postings(term string) ([]storage.Posting, error) {
+	postings := []storage.Posting{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		tb := pb.Bucket(textBucket)
+		if tb == nil {
+			return nil
+		}
+		prefix := storage.TextPrefix(term)
+		c := tb.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			p, err := storage.DecodePosting(v)
+			if err != nil {
+				return err
+			}
+			postings = append(postings, p)
+		}
+		return nil
+	})
+	return postings, err
+}
+
+// TextDocs returns the docs of the full text index, without their terms.
+func (s *Store) TextDocs() ([]fulltext.Doc, error) {
+	docs := []fulltext.Doc{}
+	err := s.DBBolt.View(func(tx *bolt.Tx) error {
+		pb := s.bucket(tx)
+		if pb == nil {
+			return nil
+		}
+		db := pb.Bucket(textDocsBucket)
+		if db == nil {
+			return nil
+		}
+		return db.ForEach(func(k []byte, v []byte) error {
+			d, _, err := storage.DecodeTextDoc(v)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, d)
+			return nil
+		})
+	})
+	return docs, err
+}
+
+// updateText replaces the postings of the issue with the given number with
+// those of the doc, or removes them when doc is nil.
+func updateText(pb *bolt.Bucket, number int, doc *fulltext.Doc) error {
+	tb, err := pb.CreateBucketIfNotExists(textBucket)
+	if err != nil {
+		return err
+	}
+	db, err := pb.CreateBucketIfNotExists(textDocsBucket)
+	if err != nil {
+		return err
+	}
+	entries := map[string][]byte{}
+	if doc != nil {
+		entries = storage.TextEntries(*doc)
+	}
+	if old := db.Get(storage.TextDocKey(number)); old != nil {
+		_, terms, err := storage.DecodeTextDoc(old)
+		if err != nil {
+			return err
+		}
+		for _, t := range terms {
+			k := storage.TextKey(t, number)
+			if _, ok := entries[string(k)]; ok {
+				continue
+			}
+			if err := tb.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	if doc == nil {
+		return db.Delete(storage.TextDocKey(number))
+	}
+	for k, v := range entries {
+		if err := tb.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return db.Put(storage.TextDocKey(number), storage.EncodeTextDoc(*doc))
+}
@@ -0,0 +1,489 @@
+// Package conformance checks that a storage backend behaves like the others.
+// The same checks run in the tests of every backend, see storagetest.Run,
+// and against the registered backends with "ogi db check".
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// checker collects the failed expectations of a run.
+type checker struct {
+	failures []error
+}
+
+// errorf records a failed expectation.
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.failures = append(c.failures, fmt.Errorf(format, args...))
+}
+
+// ok records err as a failure of the named step and reports whether it was nil.
+func (c *checker) ok(step string, err error) bool {
+	if err != nil {
+		c.errorf("%s: %s", step, err)
+		return false
+	}
+	return true
+}
+
+// Check runs the conformance checks against the database opened by open,
+// which must be empty. It returns every expectation the backend failed.
+func Check(open func() (storage.Storage, error)) []error {
+	c := &checker{}
+	root, err := open()
+	if !c.ok("open", err) {
+		return c.failures
+	}
+	defer root.Close()
+
+	if meta, err := root.Meta(); c.ok("Meta", err) && meta.SchemaVersion != storage.SchemaVersion {
+		c.errorf("Meta: a new database has schema version %d, want %d", meta.SchemaVersion, storage.SchemaVersion)
+	}
+
+	s, err := root.ForRepo("octo", "hello")
+	if !c.ok("ForRepo", err) {
+		return c.failures
+	}
+	c.checkEmpty("new repo", s)
+	c.checkIssues(s)
+	c.checkStaging(s)
+	c.checkQuery(s)
+	c.checkText(s)
+	c.checkRepos(root, s)
+
+	c.ok("Clear", s.Clear())
+	c.checkEmpty("cleared repo", s)
+	return c.failures
+}
+
+// checkEmpty checks a store holding no issues.
+func (c *checker) checkEmpty(name string, s storage.Storage) {
+	if n, err := s.Count(); c.ok(name+": Count", err) && n != 0 {
+		c.errorf("%s: Count = %d, want 0", name, n)
+	}
+	if all, err := s.All(); c.ok(name+": All", err) && len(all) != 0 {
+		c.errorf("%s: All returned %d issues, want none", name, len(all))
+	}
+	if found, err := s.Has(1); c.ok(name+": Has", err) && found {
+		c.errorf("%s: Has(1) = true, want false", name)
+	}
+	if _, err := s.Get("1"); err == nil {
+		c.errorf("%s: Get(1) found an issue", name)
+	}
+}
+
+// checkIssues checks saving, reading, moving between states and deleting.
+func (c *checker) checkIssues(s storage.Storage) {
+	first := newIssue(1, "open", "first", "a comment", "another comment")
+	first.Comments[1].Reactions = &issue.Reactions{Total: 2, Heart: 2}
+	first.Events = []issue.Event{{Type: "labeled", Actor: issue.User{Login: "octocat"}, Label: "bug"}}
+	c.ok("Save #1", s.Save(first))
+	c.ok("Save #2", s.Save(newIssue(2, "closed", "second")))
+	c.ok("Save #3", s.Save(newIssue(3, "open", "third")))
+
+	if n, err := s.Count(); c.ok("Count", err) && n != 3 {
+		c.errorf("Count = %d, want 3", n)
+	}
+	if is, err := s.Get("1"); c.ok("Get #1", err) {
+		if is.Title != "first" {
+			c.errorf("Get #1: title = %q, want %q", is.Title, "first")
+		}
+		if len(is.Comments) != 0 {
+			c.errorf("Get #1: got %d comments, want them loaded by Comments only", len(is.Comments))
+		}
+		if len(is.Events) != 1 || is.Events[0].Label != "bug" {
+			c.errorf("Get #1: got events %v, want the labeled event saved", is.Events)
+		}
+	}
+	if comments, err := s.Comments(1); c.ok("Comments #1", err) {
+		if len(comments) != 2 || comments[1].Body != "another comment" {
+			c.errorf("Comments #1: got %d comments, want the 2 saved oldest first", len(comments))
+		} else if comments[1].ReactionCount() != 2 {
+			c.errorf("Comments #1: got %d reactions on the second, want 2", comments[1].ReactionCount())
+		}
+	}
+	c.checkNumbers("AllByState(open)", s, "open", 1, 3)
+	c.checkNumbers("AllByState(closed)", s, "closed", 2)
+	if all, err := s.All(); c.ok("All", err) {
+		if got := numbers(all); len(got) != 3 || got[2] != 2 {
+			c.errorf("All = %v, want the open issues before the closed ones", got)
+		}
+	}
+	each := []issue.Issue{}
+	err := s.Each("all", true, func(i issue.Issue) error {
+		each = append(each, i)
+		return nil
+	})
+	if c.ok("Each(all)", err) {
+		if got := numbers(each); len(got) != 3 || got[2] != 2 {
+			c.errorf("Each(all) = %v, want the open issues before the closed ones", got)
+		} else if len(each[0].Comments)+len(each[1].Comments) != 2 {
+			c.errorf("Each(all): want the comments of #1 loaded")
+		}
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = s.Each("open", false, func(i issue.Issue) error {
+		calls++
+		if len(i.Comments) != 0 {
+			c.errorf("Each(open) without comments: #%d has %d comments", i.Number, len(i.Comments))
+		}
+		return stop
+	})
+	if err != stop || calls != 1 {
+		c.errorf("Each(open) = %v after %d calls, want the error of the first call", err, calls)
+	}
+
+	// an issue closed on GitHub moves to the closed issues
+	c.ok("Save #1 closed", s.Save(newIssue(1, "closed", "first, fixed", "fixed")))
+	c.checkNumbers("AllByState(open) after closing #1", s, "open", 3)
+	c.checkNumbers("AllByState(closed) after closing #1", s, "closed", 1, 2)
+	if n, err := s.Count(); c.ok("Count after closing #1", err) && n != 3 {
+		c.errorf("Count after closing #1 = %d, want 3", n)
+	}
+	if is, err := s.Get("1"); c.ok("Get #1 after closing", err) && is.Title != "first, fixed" {
+		c.errorf("Get #1 after closing: title = %q, want %q", is.Title, "first, fixed")
+	}
+	if comments, err := s.Comments(1); c.ok("Comments #1 after closing", err) && len(comments) != 1 {
+		c.errorf("Comments #1 after closing: got %d comments, want the 1 saved last", len(comments))
+	}
+
+	c.ok("Save #2 with a comment", s.Save(newIssue(2, "closed", "second", "a comment")))
+	c.ok("Delete #2", s.Delete(2))
+	if comments, err := s.Comments(2); c.ok("Comments #2 after Delete", err) && len(comments) != 0 {
+		c.errorf("Comments #2 after Delete: got %d comments, want none", len(comments))
+	}
+	if found, err := s.Has(2); c.ok("Has #2 after Delete", err) && found {
+		c.errorf("Has(2) after Delete = true, want false")
+	}
+	if err := s.Delete(2); err == nil {
+		c.errorf("Delete of a missing issue succeeded")
+	}
+	c.checkNumbers("AllByState(closed) after Delete", s, "closed", 1)
+}
+
+// checkStaging checks that staged issues only replace the stored ones on
+// Commit, and that an interrupted stage can be resumed or discarded.
+func (c *checker) checkStaging(s storage.Storage) {
+	stage, err := s.Stage()
+	if !c.ok("Stage", err) {
+		return
+	}
+	c.checkEmpty("stage", stage)
+	c.ok("Save #7 to stage", stage.Save(newIssue(7, "open", "staged")))
+	if found, err := s.Has(7); c.ok("Has #7 before Commit", err) && found {
+		c.errorf("staged issue #7 is visible before Commit")
+	}
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.ok("SaveCheckpoint", stage.SaveCheckpoint(storage.Checkpoint{Page: 3, State: "all", Started: started}))
+
+	resumed, cp, err := s.Resume()
+	if !c.ok("Resume", err) {
+		return
+	}
+	if cp.Page != 3 || cp.State != "all" || !cp.Started.Equal(started) {
+		c.errorf("Resume: checkpoint = %+v, want page 3 of all", *cp)
+	}
+	if found, err := resumed.Has(7); c.ok("Has #7 after Resume", err) && !found {
+		c.errorf("resumed stage lost issue #7")
+	}
+	c.ok("Commit", resumed.Commit())
+	c.checkNumbers("All after Commit", s, "open", 7)
+	if n, err := s.Count(); c.ok("Count after Commit", err) && n != 1 {
+		c.errorf("Count after Commit = %d, want 1", n)
+	}
+	if _, _, err := s.Resume(); err == nil {
+		c.errorf("Resume succeeded after Commit")
+	}
+
+	stage, err = s.Stage()
+	if !c.ok("second Stage", err) {
+		return
+	}
+	c.ok("Save #8 to stage", stage.Save(newIssue(8, "open", "discarded")))
+	c.ok("Discard", stage.Discard())
+	c.checkNumbers("All after Discard", s, "open", 7)
+	if _, _, err := s.Resume(); err == nil {
+		c.errorf("Resume succeeded after Discard")
+	}
+}
+
+// checkQuery checks the indexed lookups of Query, and that the indexes
+// follow the issues as they are saved again and deleted.
+func (c *checker) checkQuery(s storage.Storage) {
+	day := time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)
+	indexed := func(number int, state string, author string, updated time.Time, labels ...string) issue.Issue {
+		i := newIssue(number, state, "indexed")
+		i.User = issue.User{Login: author}
+		i.UpdatedAt = updated
+		i.CreatedAt = updated.AddDate(0, 0, -7)
+		for _, l := range labels {
+			i.Labels = append(i.Labels, issue.Label{Name: l})
+		}
+		return i
+	}
+	a := indexed(10, "open", "alice", day, "bug", "ui")
+	a.Assignees = []issue.User{{Login: "carol"}}
+	a.Milestone = &issue.Milestone{Number: 1, Title: "v1.0"}
+	c.ok("Save #10", s.Save(a))
+	b := indexed(11, "closed", "bob", day.AddDate(0, 0, 1), "bug")
+	b.Reactions = &issue.Reactions{Total: 5, Heart: 5}
+	c.ok("Save #11", s.Save(b))
+	d := indexed(12, "open", "Alice", day.AddDate(0, 0, 2), "docs")
+	d.CommentCount = 3
+	c.ok("Save #12", s.Save(d))
+
+	c.checkQueryNumbers(s, "label bug", storage.Query{Labels: [][]string{{"bug"}}}, 10, 11)
+	c.checkQueryNumbers(s, "labels bug and ui", storage.Query{Labels: [][]string{{"BUG"}, {"ui"}}}, 10)
+	c.checkQueryNumbers(s, "labels ui or docs", storage.Query{Labels: [][]string{{"ui", "docs"}}}, 10, 12)
+	c.checkQueryNumbers(s, "unassigned bugs", storage.Query{Labels: [][]string{{"bug"}}, NoAssignee: true}, 11)
+	c.checkQueryNumbers(s, "open bugs", storage.Query{State: "open", Labels: [][]string{{"bug"}}}, 10)
+	c.checkQueryNumbers(s, "author alice", storage.Query{Author: "alice"}, 10, 12)
+	c.checkQueryNumbers(s, "assignee carol", storage.Query{Assignee: "carol"}, 10)
+	c.checkQueryNumbers(s, "milestone v1.0", storage.Query{Milestone: "v1.0"}, 10)
+	c.checkQueryNumbers(s, "updated since", storage.Query{UpdatedSince: day.AddDate(0, 0, 1)}, 11, 12)
+	c.checkQueryNumbers(s, "updated before", storage.Query{UpdatedSince: day, UpdatedBefore: day.AddDate(0, 0, 1)}, 10)
+	c.checkQueryNumbers(s, "no match", storage.Query{Author: "bob", Labels: [][]string{{"docs"}}}, []int{}...)
+
+	// #7 is left by checkStaging, with no times, comments or reactions
+	c.checkQueryNumbers(s, "all by number", storage.Query{}, 7, 10, 11, 12)
+	c.checkQueryNumbers(s, "by number descending", storage.Query{Desc: true, Offset: 1, Limit: 2}, 11, 10)
+	c.checkQueryNumbers(s, "open by created", storage.Query{State: "open", Sort: "created"}, 7, 10, 12)
+	c.checkQueryNumbers(s, "latest updated", storage.Query{Sort: "updated", Desc: true, Limit: 2}, 12, 11)
+	c.checkQueryNumbers(s, "bugs by updated", storage.Query{Labels: [][]string{{"bug"}}, Sort: "updated", Desc: true}, 11, 10)
+	c.checkQueryNumbers(s, "by comments", storage.Query{Sort: "comments", Desc: true, Offset: 1, Limit: 1}, 11)
+	c.checkQueryNumbers(s, "by reactions", storage.Query{Sort: "reactions", Desc: true, Limit: 1}, 11)
+	if _, err := s.Query(storage.Query{Sort: "title"}); err == nil {
+		c.errorf("Query sorted by title succeeded")
+	}
+
+	// the old index keys go away when an issue changes
+	c.ok("Save #10 relabeled", s.Save(indexed(10, "closed", "alice", day.AddDate(0, 0, 3), "feature")))
+	c.checkQueryNumbers(s, "label bug after relabeling", storage.Query{Labels: [][]string{{"bug"}}}, 11)
+	c.checkQueryNumbers(s, "assignee after unassigning", storage.Query{Assignee: "carol"}, []int{}...)
+	c.checkQueryNumbers(s, "label feature", storage.Query{Labels: [][]string{{"feature"}}}, 10)
+	c.ok("Delete #11", s.Delete(11))
+	c.checkQueryNumbers(s, "author bob after Delete", storage.Query{Author: "bob"}, []int{}...)
+}
+
+// checkQueryNumbers checks the numbers of the issues a query returns.
+func (c *checker) checkQueryNumbers(s storage.Storage, name string, q storage.Query, want ...int) {
+	is, err := s.Query(q)
+	if !c.ok("Query "+name, err) {
+		return
+	}
+	got := numbers(is)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		c.errorf("Query %s = %v, want %v", name, got, want)
+	}
+}
+
+// checkText checks the full text index kept by Save and Delete.
+func (c *checker) checkText(s storage.Storage) {
+	a := newIssue(20, "open", "Crash on start", "it crashed again", "works for me")
+	a.Body = "The app crashes"
+	c.ok("Save #20", s.Save(a))
+	c.ok("Save #21", s.Save(newIssue(21, "closed", "Slow start")))
+
+	c.checkPostings(s, "crash", "20 [0 6 9]")
+	c.checkPostings(s, "start", "20 [2] 21 [1]")
+	c.checkPostings(s, "work", "20 [12]")
+	if d, ok := c.textDoc(s, 20); ok && (d.Length != 12 || d.TitleEnd != 4 || d.BodyEnd != 8) {
+		c.errorf("TextDocs #20 = length %d, title end %d, body end %d, want 12, 4, 8", d.Length, d.TitleEnd, d.BodyEnd)
+	}
+
+	// the old postings go away when an issue changes
+	c.ok("Save #20 edited", s.Save(newIssue(20, "open", "Hang on start")))
+	c.checkPostings(s, "crash", "")
+	c.checkPostings(s, "hang", "20 [0]")
+	c.ok("Delete #21", s.Delete(21))
+	c.checkPostings(s, "start", "20 [2]")
+	if _, ok := c.textDoc(s, 21); ok {
+		c.errorf("TextDocs still has #21 after Delete")
+	}
+}
+
+// checkPostings checks the postings of a term, written as number [positions].
+func (c *checker) checkPostings(s storage.Storage, term string, want string) {
+	postings, err := s.Postings(term)
+	if !c.ok("Postings "+term, err) {
+		return
+	}
+	got := []string{}
+	for _, p := range postings {
+		got = append(got, fmt.Sprintf("%d %v", p.Number, p.Positions))
+	}
+	if strings.Join(got, " ") != want {
+		c.errorf("Postings %s = %q, want %q", term, strings.Join(got, " "), want)
+	}
+}
+
+// textDoc returns the text doc of an issue, reporting whether there is one.
+func (c *checker) textDoc(s storage.Storage, number int) (fulltext.Doc, bool) {
+	docs, err := s.TextDocs()
+	if !c.ok("TextDocs", err) {
+		return fulltext.Doc{}, false
+	}
+	for _, d := range docs {
+		if d.Number == number {
+			return d, true
+		}
+	}
+	return fulltext.Doc{}, false
+}
+
+// checkRepos checks that repos sharing a database are kept apart.
+func (c *checker) checkRepos(root storage.Storage, s storage.Storage) {
+	other, err := root.ForRepo("octo", "hello-world")
+	if !c.ok("ForRepo of a second repo", err) {
+		return
+	}
+	c.checkEmpty("second repo", other)
+	c.ok("Save #7 to second repo", other.Save(newIssue(7, "closed", "other")))
+	if is, err := s.Get("7"); c.ok("Get #7", err) && is.Title != "staged" {
+		c.errorf("saving to a second repo changed issue #7 of the first")
+	}
+
+	updated := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	c.ok("SetLastUpdated", s.SetLastUpdated(updated))
+	repos, err := root.Repos()
+	if !c.ok("Repos", err) {
+		return
+	}
+	found := map[string]storage.Repo{}
+	for _, r := range repos {
+		found[r.Owner+"/"+r.Repo] = r
+	}
+	if len(repos) != 2 {
+		c.errorf("Repos returned %d repos, want 2", len(repos))
+	}
+	if r, ok := found["octo/hello"]; !ok || !r.LastUpdated.Equal(updated) {
+		c.errorf("Repos: octo/hello = %+v, want last updated %s", r, updated)
+	}
+	if r, ok := found["octo/hello-world"]; !ok || !r.LastUpdated.IsZero() {
+		c.errorf("Repos: octo/hello-world = %+v, want never updated", r)
+	}
+	if got := s.Repository(); got.Owner != "octo" || got.Repo != "hello" {
+		c.errorf("Repository = %s/%s, want octo/hello", got.Owner, got.Repo)
+	}
+}
+
+// checkNumbers checks the numbers of the issues stored with a state.
+func (c *checker) checkNumbers(name string, s storage.Storage, state string, want ...int) {
+	is, err := s.AllByState(state)
+	if !c.ok(name, err) {
+		return
+	}
+	got := numbers(is)
+	if len(got) != len(want) {
+		c.errorf("%s = %v, want %v", name, got, want)
+		return
+	}
+	seen := map[int]bool{}
+	for _, n := range got {
+		seen[n] = true
+	}
+	for _, n := range want {
+		if !seen[n] {
+			c.errorf("%s = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+// numbers returns the numbers of the issues.
+func numbers(is []issue.Issue) []int {
+	ns := []int{}
+	for _, i := range is {
+		ns = append(ns, i.Number)
+	}
+	return ns
+}
+
+// newIssue returns an issue with the given comments.
+func newIssue(number int, state string, title string, comments ...string) issue.Issue {
+	is := issue.Issue{
+		Number:       number,
+		State:        state,
+		Title:        title,
+		CommentCount: len(comments),
+	}
+	for i, body := range comments {
+		is.Comments = append(is.Comments, issue.Comment{
+			ID:   int64(number*100 + i),
+			Body: body,
+			User: issue.User{Login: "octocat" + strconv.Itoa(i)},
+		})
+	}
+	return is
+}
+
+// CheckUpgraded checks the database opened by root, which holds the
+// storagetest.LegacyIssues in the layout of schema version 0, was upgraded to
+// storage.SchemaVersion with the issues, comments, indexes and full text
+// index of the current layout. It returns every expectation the backend
+// failed.
+func CheckUpgraded(root storage.Storage) []error {
+	c := &checker{}
+	if meta, err := root.Meta(); c.ok("Meta", err) && meta.SchemaVersion != storage.SchemaVersion {
+		c.errorf("Meta: the upgraded database has schema version %d, want %d", meta.SchemaVersion, storage.SchemaVersion)
+	}
+	repos, err := root.Repos()
+	if c.ok("Repos", err) && (len(repos) != 1 || repos[0].Owner != "octo" || repos[0].Repo != "hello") {
+		c.errorf("Repos = %+v, want octo/hello", repos)
+	}
+	s, err := root.ForRepo("octo", "hello")
+	if !c.ok("ForRepo", err) {
+		return c.failures
+	}
+
+	c.checkNumbers("AllByState open", s, "open", 1)
+	c.checkNumbers("AllByState closed", s, "closed", 2)
+	if is, err := s.Get("1"); c.ok("Get #1", err) && (is.Title != "Crash on start" || is.User.Login != "alice" || is.CommentCount != 2) {
+		c.errorf("Get #1 = %q by %q with %d comments, want %q by alice with 2", is.Title, is.User.Login, is.CommentCount, "Crash on start")
+	}
+	if comments, err := s.Comments(1); c.ok("Comments #1", err) {
+		bodies := []string{}
+		for _, comment := range comments {
+			bodies = append(bodies, comment.Body)
+		}
+		if strings.Join(bodies, "|") != "it crashed again|works for me" {
+			c.errorf("Comments #1 = %q, want the two comments oldest first", bodies)
+		}
+	}
+
+	c.checkQueryNumbers(s, "label bug", storage.Query{Labels: [][]string{{"bug"}}}, 1)
+	c.checkQueryNumbers(s, "author bob", storage.Query{Author: "bob"}, 2)
+	c.checkQueryNumbers(s, "updated since", storage.Query{UpdatedSince: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)}, 1)
+	c.checkQueryNumbers(s, "sort created", storage.Query{Sort: "created"}, 2, 1)
+	c.checkQueryNumbers(s, "sort comments desc", storage.Query{Sort: "comments", Desc: true}, 1, 2)
+
+	c.checkPostings(s, "crash", "1 [0 6 9]")
+	c.checkPostings(s, "start", "1 [2] 2 [1]")
+	if d, ok := c.textDoc(s, 1); !ok || d.Length != 12 || d.TitleEnd != 4 || d.BodyEnd != 8 {
+		c.errorf("TextDocs #1 = length %d, title end %d, body end %d, want 12, 4, 8", d.Length, d.TitleEnd, d.BodyEnd)
+	}
+
+	// the migrated keys are those Save and Delete replace
+	is, err := s.Get("1")
+	if c.ok("Get #1", err) {
+		is.Labels = nil
+		is.Title = "Hang on start"
+		is.Body = ""
+		c.ok("Save #1 edited", s.Save(is))
+		c.checkQueryNumbers(s, "label bug after editing", storage.Query{Labels: [][]string{{"bug"}}}, []int{}...)
+		c.checkPostings(s, "crash", "")
+	}
+	c.ok("Delete #2", s.Delete(2))
+	c.checkQueryNumbers(s, "author bob after Delete", storage.Query{Author: "bob"}, []int{}...)
+	c.checkPostings(s, "start", "1 [2]")
+	return c.failures
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// The encodings below are those each schema version introduced, copied for
+// the migrations to that version. The live ones, like IndexKeys, follow the
+// latest layout, a migration must write what its own version holds as the
+// migrations after it expect exactly that. Never change them, a new layout
+// needs a new version and a new copy.
+
+// CommentKeyV3 returns the key of a comment at schema version 3: the issue
+// number followed by the comment ID, both 8 byte big endian.
+func CommentKeyV3(number int, id int64) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(number))
+	return binary.BigEndian.AppendUint64(key, uint64(id))
+}
+
+// CommentPrefixV3 returns the prefix of the keys of an issue's comments at
+// schema version 3.
+func CommentPrefixV3(number int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(number))
+}
+
+// IndexKeysV4 returns the index keys of an issue at schema version 4, by
+// label, author, assignee, milestone and update time.
+func IndexKeysV4(i issue.Issue) [][]byte {
+	exact := func(kind string, value string) []byte {
+		key := []byte(kind + "\x00" + strings.ToLower(value) + "\x00")
+		return binary.BigEndian.AppendUint64(key, uint64(i.Number))
+	}
+	keys := [][]byte{}
+	for _, l := range i.Labels {
+		keys = append(keys, exact("label", l.Name))
+	}
+	if i.User.Login != "" {
+		keys = append(keys, exact("author", i.User.Login))
+	}
+	for _, a := range i.Assignees {
+		keys = append(keys, exact("assignee", a.Login))
+	}
+	if i.Milestone != nil {
+		keys = append(keys, exact("milestone", i.Milestone.Title))
+	}
+	return append(keys, orderKeyV4("updated", unixSecondsV4(i.UpdatedAt), i.Number))
+}
+
+// IndexValueV4 returns the value of the index keys of an issue since schema
+// version 4, its number in decimal.
+func IndexValueV4(number int) []byte {
+	return []byte(strconv.Itoa(number))
+}
+
+// orderKeyV4 returns an index key ordering issues by a value since schema
+// version 4.
+func orderKeyV4(kind string, value uint64, number int) []byte {
+	key := binary.BigEndian.AppendUint64([]byte(kind+"\x00"), value)
+	key = append(key, "\x00"...)
+	return binary.BigEndian.AppendUint64(key, uint64(number))
+}
+
+// unixSecondsV4 returns a time as it is indexed since schema version 4,
+// times before 1970 as 1970.
+func unixSecondsV4(t time.Time) uint64 {
+	return uint64(max(t.Unix(), 0))
+}
+
+// TextEntriesV5 returns the postings of a doc at schema version 5, keyed by
+// the term and the 8 byte big endian issue number, the issue number and the
+// deltas of the term's positions as uvarints.
+func TextEntriesV5(d fulltext.Doc) map[string][]byte {
+	entries := map[string][]byte{}
+	for term, positions := range d.Terms {
+		v := binary.AppendUvarint(nil, uint64(d.Number))
+		last := 0
+		for _, p := range positions {
+			v = binary.AppendUvarint(v, uint64(p-last))
+			last = p
+		}
+		key := binary.BigEndian.AppendUint64([]byte(term+"\x00"), uint64(d.Number))
+		entries[string(key)] = v
+	}
+	return entries
+}
+
+// TextDocKeyV5 returns the key of the text doc of an issue at schema
+// version 5, its number 8 byte big endian.
+func TextDocKeyV5(number int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(number))
+}
+
+// EncodeTextDocV5 returns the text doc of an issue at schema version 5: its
+// number, length, title and body end as uvarints, followed by its sorted
+// terms separated by \x00.
+func EncodeTextDocV5(d fulltext.Doc) []byte {
+	v := binary.AppendUvarint(nil, uint64(d.Number))
+	v = binary.AppendUvarint(v, uint64(d.Length))
+	v = binary.AppendUvarint(v, uint64(d.TitleEnd))
+	v = binary.AppendUvarint(v, uint64(d.BodyEnd))
+	terms := []string{}
+	for t := range d.Terms {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	return append(v, strings.Join(terms, "\x00")...)
+}
+
+// IssueKeyV6 returns the key of an issue at schema version 6, its number 8
+// byte big endian.
+func IssueKeyV6(number int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(number))
+}
+
+// IndexKeysV6 returns the index keys of an issue at schema version 6, those
+// of version 4 and the keys ordering issues by creation time, comments and
+// reactions.
+func IndexKeysV6(i issue.Issue) [][]byte {
+	reactions := 0
+	if i.Reactions != nil {
+		reactions = i.Reactions.Total
+	}
+	return append(IndexKeysV4(i),
+		orderKeyV4("created", unixSecondsV4(i.CreatedAt), i.Number),
+		orderKeyV4("comments", uint64(i.CommentCount), i.Number),
+		orderKeyV4("reactions", uint64(reactions), i.Number))
+}
@@ -0,0 +1,29 @@
+package storage
+
+import "encoding/binary"
+
+// IssueKey returns the key an issue is stored under, its number big endian so
+// the issues are kept in order of their number.
+func IssueKey(number int) []byte {
+	return uint64Bytes(uint64(number))
+}
+
+// IssueNumber returns the number of the issue stored under a key.
+func IssueNumber(key []byte) int {
+	return int(binary.BigEndian.Uint64(key))
+}
+
+// CommentKey returns the key a comment is stored under, the issue number
+// followed by the comment ID, both big endian so the comments of an issue
+// are kept together, oldest first.
+func CommentKey(number int, id int64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	binary.BigEndian.PutUint64(key[8:], uint64(id))
+	return key
+}
+
+// CommentPrefix returns the prefix of the keys of an issue's comments.
+func CommentPrefix(number int) []byte {
+	return CommentKey(number, 0)[:8]
+}
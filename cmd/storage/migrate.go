@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// Migrate copies every repo stored in src, with its issues and comments, to
+// dst, which are both opened without selecting a repo. Each repo is written
+// to a staged copy and only committed once it holds the same issues as the
+// source, so a failed migration leaves the repos of dst it didn't finish as
+// they were. copied is called after each repo is committed.
+func Migrate(src Storage, dst Storage, copied func(r Repo, count int)) error {
+	repos, err := src.Repos()
+	if err != nil {
+		return err
+	}
+	for _, r := range repos {
+		from, err := src.ForRepo(r.Owner, r.Repo)
+		if err != nil {
+			return err
+		}
+		to, err := dst.ForRepo(r.Owner, r.Repo)
+		if err != nil {
+			return err
+		}
+		count, err := CopyRepo(from, to)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %s", r.Owner, r.Repo, err)
+		}
+		if !r.LastUpdated.IsZero() {
+			if err := to.SetLastUpdated(r.LastUpdated); err != nil {
+				return err
+			}
+		}
+		if copied != nil {
+			copied(r, count)
+		}
+	}
+	return nil
+}
+
+// CopyRepo replaces the issues of dst with those of src. The issues are
+// streamed one at a time into a staged copy, which is read back and checked
+// against src, by count and by checksum, before it is committed. It returns
+// the number of issues copied.
+func CopyRepo(src Storage, dst Storage) (int, error) {
+	stage, err := dst.Stage()
+	if err != nil {
+		return 0, err
+	}
+	want := &Checksum{}
+	err = src.Each("all", true, func(i issue.Issue) error {
+		if err := want.Add(i); err != nil {
+			return err
+		}
+		return stage.Save(i)
+	})
+	if err != nil {
+		stage.Discard()
+		return 0, err
+	}
+
+	got := &Checksum{}
+	err = stage.Each("all", true, got.Add)
+	if err == nil && got.Count() != want.Count() {
+		err = fmt.Errorf("copied %d issues out of %d", got.Count(), want.Count())
+	}
+	if err == nil && got.Sum() != want.Sum() {
+		err = fmt.Errorf("the copied issues don't match the source, checksum %s instead of %s", got, want)
+	}
+	if err != nil {
+		stage.Discard()
+		return 0, err
+	}
+	return want.Count(), stage.Commit()
+}
+
+// Checksum sums up issues, with their comments, as they are read one at a
+// time. The sum doesn't depend on the order they are added in.
+type Checksum struct {
+	digests [][sha256.Size]byte
+}
+
+// Add adds an issue to the checksum.
+func (c *Checksum) Add(i issue.Issue) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	c.digests = append(c.digests, sha256.Sum256(data))
+	return nil
+}
+
+// Count returns the number of issues added.
+func (c *Checksum) Count() int {
+	return len(c.digests)
+}
+
+// Sum returns the SHA-256 of the digests of the issues added, sorted so
+// their order doesn't matter, where an issue added twice still counts.
+func (c *Checksum) Sum() [sha256.Size]byte {
+	sorted := slices.Clone(c.digests)
+	slices.SortFunc(sorted, func(a, b [sha256.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	h := sha256.New()
+	for _, d := range sorted {
+		h.Write(d[:])
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// String returns the checksum in hex.
+func (c *Checksum) String() string {
+	sum := c.Sum()
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,231 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+	"github.com/tommyshem/ogi/cmd/storage/nutsdb"
+	"github.com/tommyshem/ogi/cmd/storage/storagetest"
+)
+
+// open returns a new bolt database to copy from and a new nutsdb database
+// to copy to.
+func open(t *testing.T) (storage.Storage, storage.Storage) {
+	t.Helper()
+	src, err := bolt.OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { src.Close() })
+	dst, err := nutsdb.OpenAt(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dst.Close() })
+	return src, dst
+}
+
+// dump returns the issues of a repo with their comments, encoded by number.
+func dump(t *testing.T, root storage.Storage, owner string, repo string) map[int]string {
+	t.Helper()
+	s, err := root.ForRepo(owner, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := map[int]string{}
+	err = s.Each("all", true, func(i issue.Issue) error {
+		data, err := json.Marshal(i)
+		issues[i.Number] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issues
+}
+
+func TestMigrate(t *testing.T) {
+	src, dst := open(t)
+	fixtures := storagetest.Fixtures()
+	if err := storagetest.Store(src, fixtures); err != nil {
+		t.Fatal(err)
+	}
+	// a repo only the target holds is kept
+	if err := storagetest.Store(dst, []storagetest.Fixture{{
+		Repo:   storage.Repo{Owner: "octo", Repo: "kept"},
+		Issues: fixtures[0].Issues[:1],
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := []string{}
+	err := storage.Migrate(src, dst, func(r storage.Repo, count int) {
+		copied = append(copied, fmt.Sprintf("%s/%s:%d", r.Owner, r.Repo, count))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(copied, " "); got != "my-org/hello-world:1 octo/hello:3" && got != "octo/hello:3 my-org/hello-world:1" {
+		t.Errorf("Migrate copied %s, want both repos", got)
+	}
+
+	for _, f := range fixtures {
+		want := dump(t, src, f.Repo.Owner, f.Repo.Repo)
+		if got := dump(t, dst, f.Repo.Owner, f.Repo.Repo); !maps.Equal(got, want) {
+			t.Errorf("%s/%s was copied as %v, want %v", f.Repo.Owner, f.Repo.Repo, got, want)
+		}
+	}
+	repos, err := dst.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := map[string]string{}
+	for _, r := range repos {
+		updated[r.Owner+"/"+r.Repo] = r.LastUpdated.UTC().String()
+	}
+	want := map[string]string{
+		"octo/hello":         fixtures[0].Repo.LastUpdated.String(),
+		"my-org/hello-world": fixtures[1].Repo.LastUpdated.String(),
+		"octo/kept":          time.Time{}.String(),
+	}
+	if !maps.Equal(updated, want) {
+		t.Errorf("the target holds the repos updated %v, want %v", updated, want)
+	}
+
+	// copying again replaces the issues, it doesn't add to them
+	if err := storage.Migrate(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := dump(t, dst, "octo", "hello"); len(got) != 3 {
+		t.Errorf("a second migration left %d issues in octo/hello, want 3", len(got))
+	}
+}
+
+// faulty is a database whose staged copies save the issues changed by
+// fault, and drop them when it returns false.
+type faulty struct {
+	storage.Storage
+	fault     func(i issue.Issue) (issue.Issue, bool)
+	discarded *int
+}
+
+func (f faulty) ForRepo(owner string, repo string) (storage.Storage, error) {
+	s, err := f.Storage.ForRepo(owner, repo)
+	return faulty{s, f.fault, f.discarded}, err
+}
+
+func (f faulty) Stage() (storage.Storage, error) {
+	s, err := f.Storage.Stage()
+	return faultyStage{s, f}, err
+}
+
+type faultyStage struct {
+	storage.Storage
+	f faulty
+}
+
+func (s faultyStage) Save(i issue.Issue) error {
+	i, ok := s.f.fault(i)
+	if !ok {
+		return nil
+	}
+	return s.Storage.Save(i)
+}
+
+func (s faultyStage) Discard() error {
+	*s.f.discarded++
+	return s.Storage.Discard()
+}
+
+// TestMigrateMismatch checks a repo whose staged copy doesn't match the
+// source is discarded, leaving the target's issues as they were.
+func TestMigrateMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault func(i issue.Issue) (issue.Issue, bool)
+		err   string
+	}{
+		{"an issue lost", func(i issue.Issue) (issue.Issue, bool) {
+			return i, i.Number != 2
+		}, "copied 2 issues out of 3"},
+		{"a title changed", func(i issue.Issue) (issue.Issue, bool) {
+			if i.Number == 3 {
+				i.Title = "Dogs"
+			}
+			return i, true
+		}, "checksum"},
+		{"a comment lost", func(i issue.Issue) (issue.Issue, bool) {
+			i.Comments = i.Comments[:min(len(i.Comments), 1)]
+			return i, true
+		}, "checksum"},
+		{"an issue renumbered", func(i issue.Issue) (issue.Issue, bool) {
+			if i.Number == 3 {
+				i.Number = 4
+			}
+			return i, true
+		}, "checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := open(t)
+			fixtures := storagetest.Fixtures()
+			if err := storagetest.Store(src, fixtures[:1]); err != nil {
+				t.Fatal(err)
+			}
+			old := storagetest.Fixture{
+				Repo:   storage.Repo{Owner: "octo", Repo: "hello"},
+				Issues: fixtures[1].Issues,
+			}
+			if err := storagetest.Store(dst, []storagetest.Fixture{old}); err != nil {
+				t.Fatal(err)
+			}
+			before := dump(t, dst, "octo", "hello")
+
+			discarded := 0
+			err := storage.Migrate(src, faulty{dst, tt.fault, &discarded}, func(r storage.Repo, count int) {
+				t.Errorf("Migrate committed %s/%s", r.Owner, r.Repo)
+			})
+			if err == nil || !strings.Contains(err.Error(), "octo/hello") || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Migrate = %v, want an error about octo/hello saying %q", err, tt.err)
+			}
+			if discarded != 1 {
+				t.Errorf("the staged copy was discarded %d times, want once", discarded)
+			}
+			if got := dump(t, dst, "octo", "hello"); !maps.Equal(got, before) {
+				t.Errorf("the target holds %v, want it unchanged, %v", got, before)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	sum := func(numbers ...int) string {
+		c := &storage.Checksum{}
+		for _, n := range numbers {
+			if err := c.Add(issue.Issue{Number: n, Title: "same"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return fmt.Sprint(c.Count(), c)
+	}
+	if sum(1, 2, 3) != sum(3, 1, 2) {
+		t.Errorf("the checksum depends on the order")
+	}
+	for _, other := range [][]int{{1, 2}, {1, 2, 4}, {1, 2, 3, 3}, {1, 1, 2, 3}} {
+		if sum(1, 2, 3) == sum(other...) {
+			t.Errorf("the checksum of 1, 2, 3 is the one of %v", other)
+		}
+	}
+	// records added twice don't cancel each other out
+	if sum(1, 1, 2) == sum(2, 3, 3) {
+		t.Errorf("the checksum of 1, 1, 2 is the one of 2, 3, 3")
+	}
+}
@@ -0,0 +1,92 @@
+package nutsdb
+
+import (
+	"github.com/nutsdb/nutsdb"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// Query returns the issues matching q, without their comments, in the order
+// it asks for. The indexed fields and the order are looked up in the index
+// bucket, only the issues returned are decoded.
+func (store *NutsStore) Query(q storage.Query) ([]issue.Issue, error) {
+	issues := []issue.Issue{}
+	err := store.DBNuts.View(func(tx *nutsdb.Tx) error {
+		generation := store.generation(tx)
+		numbers := func(state string) ([]int, error) {
+			found := []int{}
+			keys, states, err := tx.GetAll(store.generationBucket(generation, "map-bucket"))
+			if isNotFound(err) {
+				return found, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			for n, key := range keys {
+				if state == "" || string(states[n]) == state {
+					found = append(found, storage.IssueNumber(key))
+				}
+			}
+			return found, nil
+		}
+		scan := func(start []byte, end []byte) ([][]byte, error) {
+			values, err := tx.RangeScan(store.generationBucket(generation, "index-bucket"), start, end)
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return values, err
+		}
+		get := func(number int) (*issue.Issue, error) {
+			i := issue.Issue{}
+			found, err := store.get(tx, generation, storage.IssueKey(number), &i)
+			if err != nil || !found {
+				return nil, err
+			}
+			return &i, nil
+		}
+		var err error
+		issues, err = q.Run(numbers, scan, get)
+		return err
+	})
+	return issues, err
+}
+
+// updateIndex replaces the index keys of the issue stored under key with
+// those of the is issue, or removes them when is is nil. It must be called
+// before the stored issue is replaced or removed in the transaction. Keys
+// kept by the new issue are not deleted, as NutsDB drops a key deleted and
+// put again in the same transaction.
+func (store *NutsStore) updateIndex(tx *nutsdb.Tx, generation int, key []byte, is *issue.Issue) error {
+	indexBucket := store.generationBucket(generation, "index-bucket")
+	keep := map[string]bool{}
+	if is != nil {
+		for _, k := range storage.IndexKeys(*is) {
+			keep[string(k)] = true
+		}
+	}
+	old := issue.Issue{}
+	found, err := store.get(tx, generation, key, &old)
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, k := range storage.IndexKeys(old) {
+			if keep[string(k)] {
+				continue
+			}
+			if err := tx.Delete(indexBucket, k); err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+	}
+	if is == nil {
+		return nil
+	}
+	value := storage.IndexValue(is.Number)
+	for k := range keep {
+		if err := tx.Put(indexBucket, []byte(k), value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
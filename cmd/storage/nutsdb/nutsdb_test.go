@@ -0,0 +1,125 @@
+package nutsdb
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/conformance"
+	"github.com/tommyshem/ogi/cmd/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(dir string) (storage.Storage, error) {
+		return OpenAt(filepath.Join(dir, "issues.nutsdb"))
+	})
+}
+
+// TestReopenKeepsBuckets checks the buckets created after a database with
+// several buckets is opened again don't take over the IDs of the old ones,
+// see skipUsedBucketIDs.
+func TestReopenKeepsBuckets(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "issues.nutsdb")
+	save := func(owner string, title string) {
+		t.Helper()
+		root, err := OpenAt(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer root.Close()
+		s, err := root.ForRepo(owner, "repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(issue.Issue{Number: 1, State: "open", Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("first", "first issue")
+	save("second", "second issue")
+	save("third", "third issue")
+
+	root, err := OpenAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	for _, owner := range []string{"first", "second", "third"} {
+		s, err := root.ForRepo(owner, "repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := s.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		is, err := s.Get("1")
+		if err != nil {
+			t.Fatalf("%s: %s", owner, err)
+		}
+		if n != 1 || is.Title != owner+" issue" {
+			t.Errorf("%s: got %d issues, #1 titled %q, want 1 titled %q", owner, n, is.Title, owner+" issue")
+		}
+	}
+}
+
+// TestUpgrade checks a database written before schema versions were recorded
+// is upgraded to the current layout when it is opened.
+func TestUpgrade(t *testing.T) {
+	issues, err := storagetest.LegacyIssues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "issues.nutsdb")
+	db, err := nutsdb.Open(nutsdb.DefaultOptions, nutsdb.WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := "octo/hello:info"
+	buckets := []string{info, "octo/hello:1:bucket", "octo/hello:1:map-bucket", "octo/hello:1:comments-bucket"}
+	err = db.Update(func(tx *nutsdb.Tx) error {
+		for _, b := range buckets {
+			if err := tx.NewBucket(nutsdb.DataStructureBTree, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *nutsdb.Tx) error {
+		for k, v := range map[string]string{"owner": "octo", "repo": "hello", "generation": "1"} {
+			if err := tx.Put(info, []byte(k), []byte(v), 0); err != nil {
+				return err
+			}
+		}
+		for _, i := range issues {
+			key := []byte(strconv.Itoa(i.Number))
+			for n, v := range [][]byte{i.Data, []byte(i.State), i.Comments} {
+				if err := tx.Put(buckets[n+1], key, v, 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	for _, err := range conformance.CheckUpgraded(root) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,397 @@
+package nutsdb
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// bucket name = _meta
+//
+//	key = schema_version  storage.SchemaVersion of the layout
+//	key = ogi_version     version of ogi that created or last upgraded it
+const metaBucketName = "_meta"
+
+var (
+	schemaVersionKey = []byte("schema_version")
+	ogiVersionKey    = []byte("ogi_version")
+)
+
+// migrations upgrade a database to the schema version they are keyed by,
+// from the version before. NutsDB can't create buckets and write to them in
+// one transaction, so a migration may commit several; the new version is
+// only recorded once it is done, which means a migration must be safe to run
+// again after it was interrupted. They write the keys of their own version
+// with the frozen copies of the storage package, like storage.IndexKeysV4,
+// never with the live encodings.
+var migrations = map[int]func(store *NutsStore) error{
+	2: convertIssues,
+	3: splitComments,
+	4: buildIndexesV4,
+	5: buildTextIndex,
+	6: rekeyIssues,
+}
+
+// convertBatch is the number of issues converted per transaction, keeping
+// each well below the transaction size NutsDB allows.
+const convertBatch = 100
+
+// textBatch is the number of issues added to the full text index per
+// transaction, smaller as every issue writes a posting per term.
+const textBatch = 10
+
+// upgrade runs the migrations a database written by an older ogi needs. A
+// new database is stamped with the current schema version, a database newer
+// than this build fails with a storage.SchemaError.
+func (store *NutsStore) upgrade() error {
+	meta, err := store.Meta()
+	if err != nil || meta.SchemaVersion == storage.SchemaVersion {
+		return err
+	}
+	if meta.SchemaVersion > storage.SchemaVersion {
+		return &storage.SchemaError{Location: store.Filepath, Version: meta.SchemaVersion, OgiVersion: meta.OgiVersion}
+	}
+	if err := store.createBuckets(metaBucketName); err != nil {
+		return err
+	}
+	if meta.SchemaVersion == 0 {
+		repos, err := store.Repos()
+		if err != nil {
+			return err
+		}
+		if len(repos) == 0 {
+			// nothing to upgrade in a new database
+			return store.setSchemaVersion(storage.SchemaVersion)
+		}
+	}
+	for v := meta.SchemaVersion + 1; v <= storage.SchemaVersion; v++ {
+		if migrate, ok := migrations[v]; ok {
+			if err := migrate(store); err != nil {
+				return &storage.MigrationError{Location: store.Filepath, Version: v, Err: err}
+			}
+		}
+		if err := store.setSchemaVersion(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSchemaVersion records the schema version of the database, together with
+// the version of ogi writing it.
+func (store *NutsStore) setSchemaVersion(version int) error {
+	return store.DBNuts.Update(func(tx *nutsdb.Tx) error {
+		if err := tx.Put(metaBucketName, schemaVersionKey, []byte(strconv.Itoa(version)), 0); err != nil {
+			return err
+		}
+		return tx.Put(metaBucketName, ogiVersionKey, []byte(storage.AppVersion), 0)
+	})
+}
+
+// Meta returns the schema version of the database and the ogi version that
+// created or last upgraded it. Databases written before the _meta bucket
+// existed are at schema version 0.
+func (store *NutsStore) Meta() (storage.Meta, error) {
+	meta := storage.Meta{}
+	err := store.DBNuts.View(func(tx *nutsdb.Tx) error {
+		if !existBucket(tx, metaBucketName) {
+			return nil
+		}
+		if v, err := tx.Get(metaBucketName, ogiVersionKey); err == nil {
+			meta.OgiVersion = string(v)
+		}
+		v, err := tx.Get(metaBucketName, schemaVersionKey)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		meta.SchemaVersion, err = strconv.Atoi(string(v))
+		return err
+	})
+	return meta, err
+}
+
+// forEachGeneration calls fn with the store and generation of the live and
+// the staged issues of every repo.
+func forEachGeneration(store *NutsStore, fn func(rs *NutsStore, generation int) error) error {
+	repos, err := store.Repos()
+	if err != nil {
+		return err
+	}
+	for _, r := range repos {
+		rs := &NutsStore{Owner: r.Owner, Repo: r.Repo, DBNuts: store.DBNuts, Filepath: store.Filepath}
+		generations := []int{}
+		err := rs.DBNuts.View(func(tx *nutsdb.Tx) error {
+			generations = append(generations,
+				getInt(tx, rs.infoBucketName(), generationKey),
+				getInt(tx, rs.infoBucketName(), stagedKey))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, generation := range generations {
+			if generation == 0 {
+				continue
+			}
+			if err := fn(rs, generation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forEachIssueBatch calls fn with the keys of the issues of a generation, in
+// batches of size issues each given its own transaction.
+func (store *NutsStore) forEachIssueBatch(generation int, size int, fn func(tx *nutsdb.Tx, keys [][]byte) error) error {
+	var keys [][]byte
+	err := store.DBNuts.View(func(tx *nutsdb.Tx) error {
+		var err error
+		keys, err = tx.GetKeys(store.generationBucket(generation, "bucket"))
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += size {
+		batch := keys[start:min(start+size, len(keys))]
+		err := store.DBNuts.Update(func(tx *nutsdb.Tx) error {
+			return fn(tx, batch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertIssues rewrites the issues stored in the go-github format in ogi's
+// own issue format, for the live and the staged generation of every repo.
+// Issues already converted are skipped, so it can run again after an
+// interruption.
+func convertIssues(store *NutsStore) error {
+	return forEachGeneration(store, func(rs *NutsStore, generation int) error {
+		return rs.convertGeneration(generation)
+	})
+}
+
+// convertGeneration converts the issues of one generation, with their
+// comments.
+func (store *NutsStore) convertGeneration(generation int) error {
+	dataBucket := store.generationBucket(generation, "bucket")
+	commentsBucket := store.generationBucket(generation, "comments-bucket")
+	return store.forEachIssueBatch(generation, convertBatch, func(tx *nutsdb.Tx, keys [][]byte) error {
+		for _, key := range keys {
+			value, err := tx.Get(dataBucket, key)
+			if err != nil {
+				return err
+			}
+			if !issue.IsLegacy(value) {
+				continue
+			}
+			i, err := issue.FromLegacy(value)
+			if err != nil {
+				return err
+			}
+			if value, err := tx.Get(commentsBucket, key); err == nil {
+				if i.Comments, err = issue.CommentsFromLegacy(value); err != nil {
+					return err
+				}
+			} else if !isNotFound(err) {
+				return err
+			}
+			comments, err := json.Marshal(i.Comments)
+			if err != nil {
+				return err
+			}
+			i.Comments = nil
+			data, err := json.Marshal(i)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(dataBucket, key, data, 0); err != nil {
+				return err
+			}
+			if err := tx.Put(commentsBucket, key, comments, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// splitComments moves the comments of each issue, stored together under the
+// issue number, to a key per comment. Issues whose comments were moved are
+// skipped, so it can run again after an interruption.
+func splitComments(store *NutsStore) error {
+	return forEachGeneration(store, func(rs *NutsStore, generation int) error {
+		commentsBucket := rs.generationBucket(generation, "comments-bucket")
+		return rs.forEachIssueBatch(generation, convertBatch, func(tx *nutsdb.Tx, keys [][]byte) error {
+			for _, key := range keys {
+				value, err := tx.Get(commentsBucket, key)
+				if isNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				number, err := strconv.Atoi(string(key))
+				if err != nil {
+					return err
+				}
+				comments := []issue.Comment{}
+				if err := json.Unmarshal(value, &comments); err != nil {
+					return err
+				}
+				for _, c := range comments {
+					data, err := json.Marshal(c)
+					if err != nil {
+						return err
+					}
+					if err := tx.Put(commentsBucket, storage.CommentKeyV3(number, c.ID), data, 0); err != nil {
+						return err
+					}
+				}
+				if err := tx.Delete(commentsBucket, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// buildIndexesV4 adds the index keys of every stored issue to the index
+// bucket of its generation.
+func buildIndexesV4(store *NutsStore) error {
+	return buildIndexes(store, storage.IndexKeysV4)
+}
+
+// buildIndexes adds the index keys of every stored issue returned by
+// indexKeys to the index bucket of its generation.
+func buildIndexes(store *NutsStore, indexKeys func(i issue.Issue) [][]byte) error {
+	return forEachGeneration(store, func(rs *NutsStore, generation int) error {
+		indexBucket := rs.generationBucket(generation, "index-bucket")
+		if err := rs.createBuckets(indexBucket); err != nil {
+			return err
+		}
+		return rs.forEachIssueBatch(generation, convertBatch, func(tx *nutsdb.Tx, keys [][]byte) error {
+			for _, key := range keys {
+				i := issue.Issue{}
+				found, err := rs.get(tx, generation, key, &i)
+				if err != nil {
+					return err
+				}
+				if !found {
+					continue
+				}
+				for _, k := range indexKeys(i) {
+					if err := tx.Put(indexBucket, k, storage.IndexValueV4(i.Number), 0); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// buildTextIndex adds the title, body and comments of every stored issue to
+// the full text index of its generation. Issues already added are added
+// again, which leaves their postings as they were.
+func buildTextIndex(store *NutsStore) error {
+	return forEachGeneration(store, func(rs *NutsStore, generation int) error {
+		textBuckets := []string{
+			rs.generationBucket(generation, "text-bucket"),
+			rs.generationBucket(generation, "textdoc-bucket"),
+		}
+		if err := rs.createBuckets(textBuckets...); err != nil {
+			return err
+		}
+		commentsBucket := rs.generationBucket(generation, "comments-bucket")
+		return rs.forEachIssueBatch(generation, textBatch, func(tx *nutsdb.Tx, keys [][]byte) error {
+			for _, key := range keys {
+				i := issue.Issue{}
+				found, err := rs.get(tx, generation, key, &i)
+				if err != nil {
+					return err
+				}
+				if !found {
+					continue
+				}
+				values, err := tx.PrefixScan(commentsBucket, storage.CommentPrefixV3(i.Number), 0, nutsdb.ScanNoLimit)
+				if err != nil && !isNotFound(err) {
+					return err
+				}
+				for _, v := range values {
+					c := issue.Comment{}
+					if err := json.Unmarshal(v, &c); err != nil {
+						return err
+					}
+					i.Comments = append(i.Comments, c)
+				}
+				doc := fulltext.Analyze(i)
+				for k, v := range storage.TextEntriesV5(doc) {
+					if err := tx.Put(textBuckets[0], []byte(k), v, 0); err != nil {
+						return err
+					}
+				}
+				if err := tx.Put(textBuckets[1], storage.TextDocKeyV5(i.Number), storage.EncodeTextDocV5(doc), 0); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// rekeyIssues moves the issues and their states from keys holding their
+// number in decimal to 8 byte big endian, then adds the index keys ordering
+// them by creation time, comments and reactions. Issues already moved are
+// skipped, so it can run again after an interruption.
+func rekeyIssues(store *NutsStore) error {
+	err := forEachGeneration(store, func(rs *NutsStore, generation int) error {
+		buckets := []string{
+			rs.generationBucket(generation, "bucket"),
+			rs.generationBucket(generation, "map-bucket"),
+		}
+		return rs.forEachIssueBatch(generation, convertBatch, func(tx *nutsdb.Tx, keys [][]byte) error {
+			for _, key := range keys {
+				number, err := strconv.Atoi(string(key))
+				if err != nil {
+					continue
+				}
+				for _, bucket := range buckets {
+					value, err := tx.Get(bucket, key)
+					if isNotFound(err) {
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					if err := tx.Put(bucket, storage.IssueKeyV6(number), value, 0); err != nil {
+						return err
+					}
+					if err := tx.Delete(bucket, key); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return buildIndexes(store, storage.IndexKeysV6)
+}
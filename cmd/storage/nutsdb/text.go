@@ -0,0 +1,97 @@
+package nutsdb
+
+import (
+	"github.com/nutsdb/nutsdb"
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// Postings returns the issues a term is found in, ordered by number.
+func (store *NutsStore) Postings(term string) ([]storage.Posting, error) {
+	postings := []storage.Posting{}
+	err := store.DBNuts.View(func(tx *nutsdb.Tx) error {
+		values, err := tx.PrefixScan(store.generationBucket(store.generation(tx), "text-bucket"), storage.TextPrefix(term), 0, nutsdb.ScanNoLimit)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			p, err := storage.DecodePosting(v)
+			if err != nil {
+				return err
+			}
+			postings = append(postings, p)
+		}
+		return nil
+	})
+	return postings, err
+}
+
+// TextDocs returns the docs of the full text index, without their terms.
+func (store *NutsStore) TextDocs() ([]fulltext.Doc, error) {
+	docs := []fulltext.Doc{}
+	err := store.DBNuts.View(func(tx *nutsdb.Tx) error {
+		_, values, err := tx.GetAll(store.generationBucket(store.generation(tx), "textdoc-bucket"))
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			d, _, err := storage.DecodeTextDoc(v)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, d)
+		}
+		return nil
+	})
+	return docs, err
+}
+
+// updateText replaces the postings of the issue with the given number with
+// those of the doc, or removes them when doc is nil. Postings kept by the new
+// doc are not deleted, as NutsDB drops a key deleted and put again in the
+// same transaction.
+func (store *NutsStore) updateText(tx *nutsdb.Tx, generation int, number int, doc *fulltext.Doc) error {
+	textBucket := store.generationBucket(generation, "text-bucket")
+	docsBucket := store.generationBucket(generation, "textdoc-bucket")
+	entries := map[string][]byte{}
+	if doc != nil {
+		entries = storage.TextEntries(*doc)
+	}
+	old, err := tx.Get(docsBucket, storage.TextDocKey(number))
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if err == nil {
+		_, terms, err := storage.DecodeTextDoc(old)
+		if err != nil {
+			return err
+		}
+		for _, t := range terms {
+			k := storage.TextKey(t, number)
+			if _, ok := entries[string(k)]; ok {
+				continue
+			}
+			if err := tx.Delete(textBucket, k); err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+	}
+	if doc == nil {
+		if err := tx.Delete(docsBucket, storage.TextDocKey(number)); err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	for k, v := range entries {
+		if err := tx.Put(textBucket, []byte(k), v, 0); err != nil {
+			return err
+		}
+	}
+	return tx.Put(docsBucket, storage.TextDocKey(number), storage.EncodeTextDoc(*doc), 0)
+}
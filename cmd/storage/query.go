@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// Query selects issues by the fields the stores keep an index for. Every
+// field that is set must match, an empty Query matches every issue.
+type Query struct {
+	// State is open or closed, empty or all for both.
+	State string
+	// Labels are sets of labels, the issues must have one label of every set.
+	Labels [][]string
+	// Author is the login of the user who opened the issues.
+	Author string
+	// Assignee is the login of a user the issues are assigned to.
+	Assignee string
+	// Milestone is the title of the milestone the issues belong to.
+	Milestone string
+	// UpdatedSince and UpdatedBefore bound the time the issues were last
+	// updated, UpdatedBefore excluded.
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
+
+	// The fields below aren't indexed, they are checked on the issues
+	// found by the indexed ones.
+
+	// NoAssignee selects the issues not assigned to anybody.
+	NoAssignee bool
+	// CreatedSince is the earliest time the issues were opened.
+	CreatedSince time.Time
+
+	// Sort is the field the issues are ordered by, one of Sorts, by number
+	// when empty. Desc orders them from the largest value down, issues with
+	// the same value by number.
+	Sort string
+	Desc bool
+	// Offset skips that many of the matching issues, Limit returns at most
+	// that many of them, all when zero.
+	Offset int
+	Limit  int
+}
+
+// Sorts are the fields issues can be ordered by.
+var Sorts = []string{"number", "created", "updated", "comments", "reactions"}
+
+// index key layout
+//
+//	label \x00 name \x00 number
+//	author \x00 login \x00 number
+//	assignee \x00 login \x00 number
+//	milestone \x00 title \x00 number
+//	updated \x00 unix seconds \x00 number
+//	created \x00 unix seconds \x00 number
+//	comments \x00 count \x00 number
+//	reactions \x00 count \x00 number
+//
+// Names, logins and titles are lower cased as GitHub compares them without
+// case. Numbers, counts and times are 8 byte big endian so the keys sort in
+// order, the value of every key is the decimal issue number. The last four
+// keep every issue in the order it is sorted by, see Run.
+const sep = "\x00"
+
+// IndexKeys returns the index keys of an issue.
+func IndexKeys(i issue.Issue) [][]byte {
+	keys := [][]byte{}
+	for _, l := range i.Labels {
+		keys = append(keys, indexKey("label", l.Name, i.Number))
+	}
+	if i.User.Login != "" {
+		keys = append(keys, indexKey("author", i.User.Login, i.Number))
+	}
+	for _, a := range i.Assignees {
+		keys = append(keys, indexKey("assignee", a.Login, i.Number))
+	}
+	if i.Milestone != nil {
+		keys = append(keys, indexKey("milestone", i.Milestone.Title, i.Number))
+	}
+	keys = append(keys,
+		orderKey("updated", unixSeconds(i.UpdatedAt), i.Number),
+		orderKey("created", unixSeconds(i.CreatedAt), i.Number),
+		orderKey("comments", uint64(i.CommentCount), i.Number),
+		orderKey("reactions", uint64(i.ReactionCount()), i.Number))
+	return keys
+}
+
+// IndexValue returns the value stored under the index keys of an issue.
+func IndexValue(number int) []byte {
+	return []byte(strconv.Itoa(number))
+}
+
+// Indexed reports whether q selects issues by an indexed field, otherwise it
+// only selects them by state.
+func (q Query) Indexed() bool {
+	return len(q.Labels) > 0 || q.Author != "" || q.Assignee != "" || q.Milestone != "" ||
+		!q.UpdatedSince.IsZero() || !q.UpdatedBefore.IsZero()
+}
+
+// Numbers returns the numbers of the issues whose indexed fields match q,
+// ignoring the state. scan must return the values of the index keys from
+// start to end, both included. The lookups are intersected, starting with
+// the first one, and stop early when nothing is left.
+func (q Query) Numbers(scan func(start []byte, end []byte) ([][]byte, error)) ([]int, error) {
+	type lookup struct{ start, end []byte }
+	// an issue matches a group when any of its lookups finds it
+	groups := [][]lookup{}
+	exactLookup := func(kind string, value string) lookup {
+		prefix := []byte(kind + sep + strings.ToLower(value) + sep)
+		return lookup{prefix, append(append([]byte{}, prefix...), bytes.Repeat([]byte{0xff}, 8)...)}
+	}
+	exact := func(kind string, value string) {
+		groups = append(groups, []lookup{exactLookup(kind, value)})
+	}
+	for _, set := range q.Labels {
+		group := []lookup{}
+		for _, l := range set {
+			group = append(group, exactLookup("label", l))
+		}
+		groups = append(groups, group)
+	}
+	if q.Author != "" {
+		exact("author", q.Author)
+	}
+	if q.Assignee != "" {
+		exact("assignee", q.Assignee)
+	}
+	if q.Milestone != "" {
+		exact("milestone", q.Milestone)
+	}
+	if !q.UpdatedSince.IsZero() || !q.UpdatedBefore.IsZero() {
+		start := orderPrefix("updated", unixSeconds(q.UpdatedSince))
+		end := orderPrefix("updated", math.MaxUint64)
+		if !q.UpdatedBefore.IsZero() {
+			end = orderPrefix("updated", unixSeconds(q.UpdatedBefore.Add(-time.Second)))
+		}
+		groups = append(groups, []lookup{{start, append(end, bytes.Repeat([]byte{0xff}, 8)...)}})
+	}
+
+	var found map[int]bool
+	for _, group := range groups {
+		matched := map[int]bool{}
+		for _, l := range group {
+			values, err := scan(l.start, l.end)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				n, err := strconv.Atoi(string(v))
+				if err != nil {
+					return nil, err
+				}
+				if found == nil || found[n] {
+					matched[n] = true
+				}
+			}
+		}
+		found = matched
+		if len(found) == 0 {
+			break
+		}
+	}
+	numbers := []int{}
+	for n := range found {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// Run returns the issues matching q in its order, from Offset up to Limit,
+// with the lookups of a store: numbers returns the numbers of the stored
+// issues of a state, or of all of them for an empty one, in ascending order,
+// scan returns the values of the index keys from start to end as for Numbers,
+// and get returns the issue with a number, nil when there is none. The order
+// is read from the index, so only the issues up to the limit are decoded.
+func (q Query) Run(numbers func(state string) ([]int, error), scan func(start []byte, end []byte) ([][]byte, error), get func(number int) (*issue.Issue, error)) ([]issue.Issue, error) {
+	issues := []issue.Issue{}
+	state := q.State
+	if state == "all" {
+		state = ""
+	}
+	order, err := numbers(state)
+	if err != nil {
+		return issues, err
+	}
+	var selected map[int]bool
+	restrict := func(found []int) {
+		matched := map[int]bool{}
+		for _, n := range found {
+			if selected == nil || selected[n] {
+				matched[n] = true
+			}
+		}
+		selected = matched
+	}
+	if q.Indexed() {
+		found, err := q.Numbers(scan)
+		if err != nil {
+			return issues, err
+		}
+		restrict(found)
+	}
+	if q.Sort != "" && q.Sort != "number" {
+		if !slices.Contains(Sorts, q.Sort) {
+			return issues, fmt.Errorf("issues can't be sorted by %q, only by %s", q.Sort, strings.Join(Sorts, ", "))
+		}
+		if state != "" {
+			restrict(order)
+		}
+		values, err := scan(orderPrefix(q.Sort, 0), append(orderPrefix(q.Sort, math.MaxUint64), bytes.Repeat([]byte{0xff}, 8)...))
+		if err != nil {
+			return issues, err
+		}
+		order = []int{}
+		for _, v := range values {
+			n, err := strconv.Atoi(string(v))
+			if err != nil {
+				return issues, err
+			}
+			order = append(order, n)
+		}
+	}
+	if q.Desc {
+		slices.Reverse(order)
+	}
+	skipped := 0
+	for _, n := range order {
+		if selected != nil && !selected[n] {
+			continue
+		}
+		i, err := get(n)
+		if err != nil {
+			return issues, err
+		}
+		if i == nil || !q.Match(*i) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		issues = append(issues, *i)
+		if q.Limit > 0 && len(issues) == q.Limit {
+			break
+		}
+	}
+	return issues, nil
+}
+
+// Match reports whether the issue matches q, comparing the fields the way
+// the indexes do.
+func (q Query) Match(i issue.Issue) bool {
+	if q.State != "" && q.State != "all" && i.State != q.State {
+		return false
+	}
+	for _, set := range q.Labels {
+		found := false
+		for _, want := range set {
+			for _, l := range i.Labels {
+				found = found || strings.EqualFold(l.Name, want)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Author != "" && !strings.EqualFold(i.User.Login, q.Author) {
+		return false
+	}
+	if q.Assignee != "" {
+		found := false
+		for _, a := range i.Assignees {
+			found = found || strings.EqualFold(a.Login, q.Assignee)
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Milestone != "" && (i.Milestone == nil || !strings.EqualFold(i.Milestone.Title, q.Milestone)) {
+		return false
+	}
+	updated := i.UpdatedAt.Truncate(time.Second)
+	if !q.UpdatedSince.IsZero() && updated.Before(q.UpdatedSince.Truncate(time.Second)) {
+		return false
+	}
+	if !q.UpdatedBefore.IsZero() && !updated.Before(q.UpdatedBefore) {
+		return false
+	}
+	if q.NoAssignee && len(i.Assignees) > 0 {
+		return false
+	}
+	if !q.CreatedSince.IsZero() && i.CreatedAt.Before(q.CreatedSince) {
+		return false
+	}
+	return true
+}
+
+// indexKey returns the key of an exact match index entry.
+func indexKey(kind string, value string, number int) []byte {
+	key := []byte(kind + sep + strings.ToLower(value) + sep)
+	return append(key, uint64Bytes(uint64(number))...)
+}
+
+// orderKey returns the key of an index entry ordering issues by a value.
+func orderKey(kind string, value uint64, number int) []byte {
+	return append(orderPrefix(kind, value), uint64Bytes(uint64(number))...)
+}
+
+// orderPrefix returns the start of the index keys of a value.
+func orderPrefix(kind string, value uint64) []byte {
+	key := []byte(kind + sep)
+	key = append(key, uint64Bytes(value)...)
+	return append(key, sep...)
+}
+
+// unixSeconds returns a time as it is indexed, times before 1970 as 1970.
+func unixSeconds(t time.Time) uint64 {
+	seconds := t.Unix()
+	if seconds < 0 {
+		seconds = 0
+	}
+	return uint64(seconds)
+}
+
+func uint64Bytes(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
@@ -0,0 +1,58 @@
+package storage
+
+import "fmt"
+
+// SchemaVersion is the version of the database layout this build reads and
+// writes. Every backend upgrades older databases to it when they are opened,
+// with one migration per version, and refuses to open newer ones. The
+// migrations write with copies of the encodings of their version, like
+// IndexKeysV4, which never change.
+//
+//	1: the repo of each bucket is recorded with its issues
+//	2: issues are stored in ogi's own issue format instead of go-github's
+//	3: comments are stored on their own, keyed by issue number and comment ID
+//	4: issues are indexed by label, author, assignee, milestone and update
+//	   time, see IndexKeys
+//	5: the title, body and comments of issues are in a full text index, see
+//	   TextEntries
+//	6: issues are keyed by their number big endian instead of in decimal,
+//	   see IssueKey, and indexed by creation time, comments and reactions
+const SchemaVersion = 6
+
+// AppVersion is the version of ogi recorded in the databases it creates or
+// upgrades. It is set by the cmd package.
+var AppVersion = "dev"
+
+// Meta describes the layout of a database.
+type Meta struct {
+	// SchemaVersion is the version of the layout the issues are stored with.
+	SchemaVersion int
+	// OgiVersion is the version of ogi that created or last upgraded the
+	// database.
+	OgiVersion string
+}
+
+// SchemaError is returned when a database was written by a newer version of
+// ogi, with a layout this build doesn't understand.
+type SchemaError struct {
+	Location   string
+	Version    int
+	OgiVersion string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("the database at %s has schema version %d, written by ogi %s, but this ogi %s only understands up to version %d. Please upgrade ogi.",
+		e.Location, e.Version, e.OgiVersion, AppVersion, SchemaVersion)
+}
+
+// MigrationError is returned when upgrading a database to a schema version
+// failed. The database is left at the version before.
+type MigrationError struct {
+	Location string
+	Version  int
+	Err      error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("upgrading the database at %s to schema version %d failed: %s", e.Location, e.Version, e.Err)
+}
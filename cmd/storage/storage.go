@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+	"github.com/tommyshem/ogi/cmd/issue"
+)
+
+// DefaultBackend is the backend used when none is configured.
+const DefaultBackend = "bolt"
+
+// Storage is implemented by every storage backend. A Storage holds the issues
+// of one GitHub repo; ForRepo returns one for another repo of the same
+// database.
+type Storage interface {
+	// Repository returns the owner and repo the store holds. LastUpdated is
+	// not filled in, use Repos for it.
+	Repository() Repo
+
+	Clear() error
+	// Save stores the issue, replacing its stored comments with the ones
+	// it holds.
+	Save(is issue.Issue) error
+	// Get, All and AllByState return the issues without their comments, use
+	// Comments to load those.
+	Get(number string) (issue.Issue, error)
+	All() ([]issue.Issue, error)
+	AllByState(state string) ([]issue.Issue, error)
+	// Each calls fn with the issues of a state, open, closed or all, one at
+	// a time in the order All returns them, so a whole repo is never held
+	// in memory. The comments are loaded when withComments is set. fn must
+	// not write to the store, Each stops at the first error it returns.
+	Each(state string, withComments bool, fn func(i issue.Issue) error) error
+	// Comments returns the stored comments of an issue, oldest first.
+	Comments(number int) ([]issue.Comment, error)
+	// Query returns the issues matching q, without their comments, looking
+	// them up in the indexes kept by Save and Delete.
+	Query(q Query) ([]issue.Issue, error)
+	// Postings returns the issues a term is found in, looked up in the full
+	// text index kept by Save and Delete. Terms are stemmed, see
+	// fulltext.Terms.
+	Postings(term string) ([]Posting, error)
+	// TextDocs returns the docs of the full text index, without their terms.
+	TextDocs() ([]fulltext.Doc, error)
+	Delete(number int) error
+	Has(number int) (bool, error)
+	Count() (int, error)
+
+	// ForRepo returns a Storage for another repo sharing the database.
+	ForRepo(owner string, repo string) (Storage, error)
+	// Repos returns every repo stored in the database.
+	Repos() ([]Repo, error)
+	// SetLastUpdated records the time the repo was last synced with GitHub.
+	SetLastUpdated(t time.Time) error
+
+	// Stage returns a Storage writing to an empty staging copy of the repo,
+	// which Commit swaps in for the stored issues and Discard throws away.
+	Stage() (Storage, error)
+	// Resume returns the Storage of the repo's interrupted staged fetch and
+	// its checkpoint.
+	Resume() (Storage, *Checkpoint, error)
+	SaveCheckpoint(c Checkpoint) error
+	Commit() error
+	Discard() error
+
+	// Meta returns the schema version of the database and the ogi version
+	// that created or last upgraded it.
+	Meta() (Meta, error)
+
+	// Close releases the database.
+	Close() error
+}
+
+// Repo describes a GitHub repository stored in the database.
+type Repo struct {
+	Owner       string
+	Repo        string
+	LastUpdated time.Time
+}
+
+// Checkpoint records how far a staged fetch got so it can be resumed. The
+// issues already staged have their comments, as an issue is saved together
+// with its comments.
+type Checkpoint struct {
+	// Page is the first page of issues not completely staged yet.
+	Page    int
+	State   string
+	Pulls   bool
+	Started time.Time
+}
+
+// Backend describes a registered storage backend.
+type Backend struct {
+	// OpenAt opens the backend's database at the given path without
+	// selecting a repo, use ForRepo on the returned Storage to get one for a
+	// repo.
+	OpenAt func(location string) (Storage, error)
+	// Location returns the path of the backend's database file or folder.
+	Location func() string
+}
+
+// Open opens the backend's database at its default location.
+func (b Backend) Open() (Storage, error) {
+	return b.OpenAt(b.Location())
+}
+
+var backends = map[string]Backend{}
+
+// Register makes a backend available under the given name. It is called from
+// the init function of the backend's package.
+func Register(name string, backend Backend) {
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("storage backend %q registered twice", name))
+	}
+	backends[name] = backend
+}
+
+// Lookup returns the backend registered under the given name.
+func Lookup(name string) (Backend, error) {
+	backend, ok := backends[name]
+	if !ok {
+		return Backend{}, fmt.Errorf("unknown storage backend %q, use one of %v", name, Backends())
+	}
+	return backend, nil
+}
+
+// Backends returns the names of the registered backends.
+func Backends() []string {
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the database of the named backend without selecting a repo.
+func Open(name string) (Storage, error) {
+	backend, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open()
+}
+
+// New opens the database of the named backend and returns a Storage for the
+// specified GitHub owner and repo.
+func New(name string, owner string, repo string) (Storage, error) {
+	s, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.ForRepo(owner, repo)
+}
@@ -0,0 +1,66 @@
+package storagetest
+
+import (
+	"time"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// Fixture is a repo and the issues a test stores in it.
+type Fixture struct {
+	Repo   storage.Repo
+	Issues []issue.Issue
+}
+
+// Fixtures returns repos holding issues with comments, events and
+// reactions, for tests copying whole databases.
+func Fixtures() []Fixture {
+	crash := newIssue(1, "open", "Crash on start", "it crashed again", "works for me")
+	crash.Body = "The app crashes"
+	crash.User = issue.User{Login: "alice"}
+	crash.Labels = []issue.Label{{Name: "bug"}}
+	crash.Reactions = &issue.Reactions{Total: 3, PlusOne: 3}
+	crash.Comments[0].Reactions = &issue.Reactions{Total: 1, Heart: 1}
+	crash.Events = []issue.Event{{Type: "labeled", Actor: issue.User{Login: "octocat"}, Label: "bug"}}
+	crash.CreatedAt = time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	crash.UpdatedAt = time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	slow := newIssue(2, "closed", "Slow start")
+	slow.User = issue.User{Login: "bob"}
+	closed := time.Date(2020, 1, 3, 12, 0, 0, 0, time.UTC)
+	slow.ClosedAt = &closed
+
+	return []Fixture{
+		{
+			Repo:   storage.Repo{Owner: "octo", Repo: "hello", LastUpdated: time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)},
+			Issues: []issue.Issue{crash, slow, newIssue(3, "open", "Docs", "typo")},
+		},
+		{
+			Repo:   storage.Repo{Owner: "my-org", Repo: "hello-world"},
+			Issues: []issue.Issue{newIssue(7, "closed", "other", "a", "b", "c")},
+		},
+	}
+}
+
+// Store saves the fixtures' issues to the repos of root, which is opened
+// without selecting a repo, and records when the repos were last updated.
+func Store(root storage.Storage, fixtures []Fixture) error {
+	for _, f := range fixtures {
+		s, err := root.ForRepo(f.Repo.Owner, f.Repo.Repo)
+		if err != nil {
+			return err
+		}
+		for _, i := range f.Issues {
+			if err := s.Save(i); err != nil {
+				return err
+			}
+		}
+		if !f.Repo.LastUpdated.IsZero() {
+			if err := s.SetLastUpdated(f.Repo.LastUpdated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package storagetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// LegacyIssue is an issue of the repo octo/hello as the first versions of
+// ogi stored it, before databases recorded a schema version: in the
+// go-github format, keyed by its number in decimal.
+type LegacyIssue struct {
+	Number int
+	State  string
+	// Issue is the issue with its comments, as the bolt backend stored it.
+	Issue []byte
+	// Data and Comments are the issue without its comments and the
+	// comments, as the nutsdb backend stored them.
+	Data     []byte
+	Comments []byte
+}
+
+// LegacyIssues returns the issues a backend test writes to a database in the
+// layout of schema version 0, to run conformance.CheckUpgraded on it once it
+// is opened.
+func LegacyIssues() ([]LegacyIssue, error) {
+	type legacy struct {
+		github.Issue
+		Comments []*github.IssueComment
+	}
+	user := func(login string) *github.User { return &github.User{Login: github.String(login)} }
+	day := func(n int) *time.Time {
+		t := time.Date(2020, 1, n, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	newIssue := func(number int, state string, title string, body string, author string, label string, created int, updated int) legacy {
+		return legacy{Issue: github.Issue{
+			Number:        github.Int(number),
+			State:         github.String(state),
+			Title:         github.String(title),
+			Body:          github.String(body),
+			User:          user(author),
+			Labels:        []github.Label{{Name: github.String(label)}},
+			CreatedAt:     day(created),
+			UpdatedAt:     day(updated),
+			RepositoryURL: github.String("https://api.github.com/repos/octo/hello"),
+			HTMLURL:       github.String(fmt.Sprintf("https://github.com/octo/hello/issues/%d", number)),
+		}}
+	}
+	crash := newIssue(1, "open", "Crash on start", "The app crashes", "alice", "bug", 2, 5)
+	for n, body := range []string{"it crashed again", "works for me"} {
+		crash.Comments = append(crash.Comments, &github.IssueComment{
+			ID:        github.Int64(int64(101 + n)),
+			Body:      github.String(body),
+			User:      user([]string{"bob", "carol"}[n]),
+			CreatedAt: day(3 + n),
+		})
+	}
+	crash.Issue.Comments = github.Int(len(crash.Comments))
+	slow := newIssue(2, "closed", "Slow start", "", "bob", "feature", 1, 3)
+
+	issues := []LegacyIssue{}
+	for _, li := range []legacy{crash, slow} {
+		i := LegacyIssue{Number: li.GetNumber(), State: li.GetState()}
+		var err error
+		if i.Issue, err = json.Marshal(li); err != nil {
+			return nil, err
+		}
+		if i.Comments, err = json.Marshal(li.Comments); err != nil {
+			return nil, err
+		}
+		li.Comments = nil
+		if i.Data, err = json.Marshal(li); err != nil {
+			return nil, err
+		}
+		issues = append(issues, i)
+	}
+	return issues, nil
+}
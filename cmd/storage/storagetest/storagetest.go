@@ -0,0 +1,42 @@
+// Package storagetest runs the conformance checks in the tests of the
+// storage backends, and holds the issues they store to test upgrades and
+// copies of whole databases.
+package storagetest
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage"
+	"github.com/tommyshem/ogi/cmd/storage/conformance"
+)
+
+// Run runs the conformance checks as a test of a backend, against a new
+// database opened by open in a temporary folder of the test.
+func Run(t *testing.T, open func(dir string) (storage.Storage, error)) {
+	t.Helper()
+	for _, err := range conformance.Check(func() (storage.Storage, error) {
+		return open(t.TempDir())
+	}) {
+		t.Error(err)
+	}
+}
+
+// newIssue returns an issue with the given comments.
+func newIssue(number int, state string, title string, comments ...string) issue.Issue {
+	is := issue.Issue{
+		Number:       number,
+		State:        state,
+		Title:        title,
+		CommentCount: len(comments),
+	}
+	for i, body := range comments {
+		is.Comments = append(is.Comments, issue.Comment{
+			ID:   int64(number*100 + i),
+			Body: body,
+			User: issue.User{Login: "octocat" + strconv.Itoa(i)},
+		})
+	}
+	return is
+}
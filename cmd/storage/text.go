@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/tommyshem/ogi/cmd/fulltext"
+)
+
+// Posting is an issue a term of the full text index is found in, with the
+// positions of the term in the issue, see fulltext.Doc.
+type Posting struct {
+	Number    int
+	Positions []int
+}
+
+// full text index layout
+//
+//	text:      term \x00 number -> number and positions of the term
+//	text docs: number -> number, length, title and body end, terms
+//
+// The number is 8 byte big endian in the keys, the values are uvarints. The
+// number is repeated in the values as the NutsDB scans only return those.
+// The terms of a doc are kept so Save and Delete can remove its postings.
+
+// TextKey returns the key of the posting of a term in an issue.
+func TextKey(term string, number int) []byte {
+	return append(TextPrefix(term), uint64Bytes(uint64(number))...)
+}
+
+// TextPrefix returns the prefix of the keys of the postings of a term.
+func TextPrefix(term string) []byte {
+	return []byte(term + sep)
+}
+
+// TextDocKey returns the key of the text doc of an issue.
+func TextDocKey(number int) []byte {
+	return uint64Bytes(uint64(number))
+}
+
+// TextEntries returns the postings of a doc, keyed by their TextKey.
+func TextEntries(d fulltext.Doc) map[string][]byte {
+	entries := map[string][]byte{}
+	for term, positions := range d.Terms {
+		v := binary.AppendUvarint(nil, uint64(d.Number))
+		last := 0
+		for _, p := range positions {
+			v = binary.AppendUvarint(v, uint64(p-last))
+			last = p
+		}
+		entries[string(TextKey(term, d.Number))] = v
+	}
+	return entries
+}
+
+// DecodePosting decodes the value of a posting.
+func DecodePosting(v []byte) (Posting, error) {
+	p := Posting{}
+	values, err := uvarints(v)
+	if err != nil {
+		return p, err
+	}
+	if len(values) == 0 {
+		return p, errors.New("broken full text posting")
+	}
+	p.Number = int(values[0])
+	last := 0
+	for _, delta := range values[1:] {
+		last += int(delta)
+		p.Positions = append(p.Positions, last)
+	}
+	return p, nil
+}
+
+// EncodeTextDoc returns the value of the text doc of an issue.
+func EncodeTextDoc(d fulltext.Doc) []byte {
+	v := binary.AppendUvarint(nil, uint64(d.Number))
+	v = binary.AppendUvarint(v, uint64(d.Length))
+	v = binary.AppendUvarint(v, uint64(d.TitleEnd))
+	v = binary.AppendUvarint(v, uint64(d.BodyEnd))
+	terms := []string{}
+	for t := range d.Terms {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	return append(v, strings.Join(terms, sep)...)
+}
+
+// DecodeTextDoc decodes the value of a text doc. The Terms of the doc are
+// left nil, the names of its terms are returned on their own.
+func DecodeTextDoc(v []byte) (fulltext.Doc, []string, error) {
+	d := fulltext.Doc{}
+	fields := make([]int, 4)
+	for n := range fields {
+		x, size := binary.Uvarint(v)
+		if size <= 0 {
+			return d, nil, errors.New("broken full text doc")
+		}
+		fields[n] = int(x)
+		v = v[size:]
+	}
+	d.Number, d.Length, d.TitleEnd, d.BodyEnd = fields[0], fields[1], fields[2], fields[3]
+	terms := []string{}
+	if len(v) > 0 {
+		terms = strings.Split(string(v), sep)
+	}
+	return d, terms, nil
+}
+
+// uvarints decodes a sequence of uvarints.
+func uvarints(v []byte) ([]uint64, error) {
+	values := []uint64{}
+	for len(v) > 0 {
+		x, size := binary.Uvarint(v)
+		if size <= 0 {
+			return nil, errors.New("broken uvarint")
+		}
+		values = append(values, x)
+		v = v[size:]
+	}
+	return values, nil
+}
@@ -1,7 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/storage"
 )
 
 var updateAll bool
@@ -10,13 +19,212 @@ var updateAll bool
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "update offline issues to local ogi database",
+	Long: `Updates the issues stored locally for the repo.
+Only the issues that changed on GitHub since the last fetch or update are
+downloaded, in the state the repo was fetched with. They are merged into the
+local database together with their comments, and stored issues are moved
+between open and closed when their state changed.
+
+You need to run "ogi fetch owner/repo" once before you can update.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
-		//TODO write update func
+		if updateAll {
+			updateAllRepos()
+			return
+		}
+		config = LoadConfig()
+		if config.Repo == "" {
+			fmt.Println(`
+It looks like you haven't initialized OGI yet!
+
+Run "ogi fetch owner/repo" first to fetch all of the issues for a repository.`)
+			os.Exit(-1)
+		}
+		if config.LastUpdated.IsZero() {
+			fmt.Printf("%s/%s has never been fetched, run \"ogi fetch\" first.\n", config.Owner, config.Repo)
+			os.Exit(-1)
+		}
+		s, err := storage.New(backendName(), config.Owner, config.Repo)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		db = s
+
+		spin := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+		spin.Suffix = fmt.Sprintf(" Updating issues changed since %s", config.LastUpdated.In(time.Local))
+		spin.Start()
+
+		f := newFetcher(newClient(), concurrency)
+		f.onWait = spinnerWait(spin)
+		started := time.Now()
+		count, failed, err := updateRepo(context.Background(), f, db, config.LastUpdated, config.State, config.Option("pulls"))
+		spin.Stop()
+		if err != nil {
+			fmt.Printf("\n%s\n", err.Error())
+			os.Exit(2)
+		}
+		fmt.Printf("\nUpdated %d issues for %s\n", count-len(failed), config.Name())
+		if len(failed) > 0 {
+			// keep the last updated time so the next update asks for the
+			// failed issues again.
+			printIssueErrors(failed)
+			os.Exit(2)
+		}
+		config.LastUpdated = started
+		config.Save()
+		if err := db.SetLastUpdated(started); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
-// init registers the version command with the root command.
+// updateAllRepos syncs every repository stored in the offline database, each
+// from its own last updated time, and prints a summary line per repository.
+// Repos without a last updated time in the database fall back to the one of
+// the central registry, and are skipped when neither has one.
+func updateAllRepos() {
+	s, err := storage.Open(backendName())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	repos, err := s.Repos()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	if len(repos) == 0 {
+		fmt.Println("There are no repos stored in the offline database yet.")
+		return
+	}
+
+	global := LoadGlobalConfig()
+	ctx := context.Background()
+	f := newFetcher(newClient(), concurrency)
+	failed := 0
+	for _, r := range repos {
+		since := r.LastUpdated
+		rc := global.Find(r.Owner, r.Repo)
+		if rc == nil {
+			rc = &Config{Owner: r.Owner, Repo: r.Repo}
+		}
+		if since.IsZero() {
+			since = rc.LastUpdated
+		}
+		if since.IsZero() {
+			fmt.Printf("%s/%s: skipped, no last updated time recorded. Run \"ogi fetch %s/%s\" first.\n", r.Owner, r.Repo, r.Owner, r.Repo)
+			continue
+		}
+
+		rs, err := s.ForRepo(r.Owner, r.Repo)
+		if err != nil {
+			fmt.Printf("%s/%s: %s\n", r.Owner, r.Repo, err)
+			failed++
+			continue
+		}
+		started := time.Now()
+		count, issueErrs, err := updateRepo(ctx, f, rs, since, rc.State, rc.Option("pulls"))
+		if err == nil && len(issueErrs) == 0 {
+			err = rs.SetLastUpdated(started)
+		}
+		if err != nil {
+			fmt.Printf("%s/%s: failed after %d issues: %s\n", r.Owner, r.Repo, count, err)
+			failed++
+			continue
+		}
+		if len(issueErrs) > 0 {
+			fmt.Printf("%s/%s: updated %d issues, %d failed\n", r.Owner, r.Repo, count-len(issueErrs), len(issueErrs))
+			for _, err := range issueErrs {
+				fmt.Printf("\t%s\n", err)
+			}
+			failed++
+			continue
+		}
+		rc.LastUpdated = started
+		global.Put(rc)
+		fmt.Printf("%s/%s: updated %d issues\n", r.Owner, r.Repo, count)
+	}
+	if err := global.Save(); err != nil {
+		fmt.Printf("Could not save %s: %s\n", GlobalConfigLocation(), err)
+	}
+	if failed > 0 {
+		os.Exit(2)
+	}
+}
+
+// updateRepo asks GitHub for every issue of the store's repo in state, open,
+// closed or all like the repo was fetched with, that changed since the given
+// time and merges each one, with its comments, into the store. When the
+// state isn't all, the issues of the other state that changed are listed in
+// a second pass, only to move the stored ones that were closed or reopened
+// since. When pulls is set the review data of pull requests is refreshed as
+// well. It returns the number of changed issues and the errors of the issues
+// that could not be updated. An error is only returned when listing the
+// issues failed.
+func updateRepo(ctx context.Context, f *fetcher, s storage.Storage, since time.Time, state string, pulls bool) (int, []error, error) {
+	if state == "" {
+		state = "all"
+	}
+	count, failed, err := updateState(ctx, f, s, since, state, false, pulls)
+	if err != nil || state == "all" {
+		return count, failed, err
+	}
+	other := "closed"
+	if state == "closed" {
+		other = "open"
+	}
+	moved, more, err := updateState(ctx, f, s, since, other, true, pulls)
+	return count + moved, append(failed, more...), err
+}
+
+// updateState merges the issues in state that changed since the given time
+// into the store, only the ones it already holds when storedOnly is set. It
+// returns the number of issues merged and the errors of the ones that failed.
+func updateState(ctx context.Context, f *fetcher, s storage.Storage, since time.Time, state string, storedOnly bool, pulls bool) (int, []error, error) {
+	r := s.Repository()
+	count := 0
+	failed := []error{}
+	opts := &github.IssueListByRepoOptions{
+		State:       state,
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := f.listIssues(ctx, r.Owner, r.Repo, opts)
+		if err != nil {
+			return count, failed, err
+		}
+		if storedOnly {
+			stored := issues[:0]
+			for _, gi := range issues {
+				found, err := s.Has(gi.GetNumber())
+				if err != nil {
+					return count, failed, err
+				}
+				if found {
+					stored = append(stored, gi)
+				}
+			}
+			issues = stored
+		}
+		count += len(issues)
+
+		failed = append(failed, f.Run(ctx, len(issues), func(i int) error {
+			return fetchIssue(ctx, f, s, issues[i], pulls)
+		})...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return count, failed, nil
+}
+
+// init registers the update command with the root command.
 func init() {
 	RootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().IntVarP(&concurrency, "concurrency", "j", 4, "Number of issues fetched at the same time")
 	updateCmd.Flags().BoolVarP(&updateAll, "all", "a", false, "Fetch issues from all the repo's stored in the offline database")
 }
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+)
+
+// fakeGitHub serves the issues that changed by state, with no comments or
+// events, and records which states were listed and which issues fetched.
+type fakeGitHub struct {
+	issues map[string][]*github.Issue
+
+	mu      sync.Mutex
+	listed  []string
+	fetched []int
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if r.URL.Path == "/repos/octo/hello/issues" {
+		state := r.URL.Query().Get("state")
+		g.listed = append(g.listed, state)
+		json.NewEncoder(w).Encode(g.issues[state])
+		return
+	}
+	var number int
+	var kind string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/repos/octo/hello/issues/"), "%d/%s", &number, &kind)
+	switch kind {
+	case "comments":
+		g.fetched = append(g.fetched, number)
+		fmt.Fprint(w, "[]")
+	case "timeline":
+		fmt.Fprint(w, "[]")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUpdateRepo(t *testing.T) {
+	gh := func(number int, state string) *github.Issue {
+		return &github.Issue{Number: github.Int(number), State: github.String(state), Title: github.String(fmt.Sprintf("#%d %s", number, state))}
+	}
+	tests := []struct {
+		name   string
+		state  string
+		stored map[int]string
+		// changed are the issues GitHub lists by state, the changes of every
+		// state are listed for all
+		changed map[string][]*github.Issue
+		listed  string
+		fetched string
+		count   int
+		open    string
+		closed  string
+	}{
+		{
+			name:   "open",
+			state:  "open",
+			stored: map[int]string{1: "open", 3: "open"},
+			changed: map[string][]*github.Issue{
+				"open":   {gh(3, "open"), gh(5, "open")},
+				"closed": {gh(1, "closed"), gh(2, "closed")},
+			},
+			// #2 was never stored, so it's left out
+			listed: "[open closed]", fetched: "[1 3 5]", count: 3,
+			open: "[3 5]", closed: "[1]",
+		},
+		{
+			name:   "closed",
+			state:  "closed",
+			stored: map[int]string{1: "closed", 2: "closed"},
+			changed: map[string][]*github.Issue{
+				"closed": {gh(4, "closed")},
+				"open":   {gh(2, "open"), gh(6, "open")},
+			},
+			// #2 was reopened, #6 never stored
+			listed: "[closed open]", fetched: "[2 4]", count: 2,
+			open: "[2]", closed: "[1 4]",
+		},
+		{
+			name:   "all",
+			state:  "all",
+			stored: map[int]string{1: "open", 2: "closed"},
+			changed: map[string][]*github.Issue{
+				"all": {gh(1, "closed"), gh(2, "open"), gh(3, "open")},
+			},
+			listed: "[all]", fetched: "[1 2 3]", count: 3,
+			open: "[2 3]", closed: "[1]",
+		},
+		{
+			name:   "no state recorded",
+			state:  "",
+			stored: map[int]string{1: "open"},
+			changed: map[string][]*github.Issue{
+				"all": {gh(1, "closed"), gh(2, "closed")},
+			},
+			listed: "[all]", fetched: "[1 2]", count: 2,
+			open: "[]", closed: "[1 2]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := bolt.OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+			s, err := root.ForRepo("octo", "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for number, state := range tt.stored {
+				if err := s.Save(issue.Issue{Number: number, State: state}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			g := &fakeGitHub{issues: tt.changed}
+			srv := httptest.NewServer(g)
+			defer srv.Close()
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+			count, failed, err := updateRepo(context.Background(), newFetcher(client, 2), s, time.Now().Add(-time.Hour), tt.state, false)
+			if err != nil || len(failed) > 0 {
+				t.Fatalf("updateRepo: %v, %v", err, failed)
+			}
+			slices.Sort(g.fetched)
+			if count != tt.count || fmt.Sprint(g.listed) != tt.listed || fmt.Sprint(g.fetched) != tt.fetched {
+				t.Errorf("updateRepo updated %d issues, listed %v and fetched %v, want %d, %s and %s",
+					count, g.listed, g.fetched, tt.count, tt.listed, tt.fetched)
+			}
+			for state, want := range map[string]string{"open": tt.open, "closed": tt.closed} {
+				issues, err := s.AllByState(state)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []int{}
+				for _, i := range issues {
+					got = append(got, i.Number)
+				}
+				slices.Sort(got)
+				if fmt.Sprint(got) != want {
+					t.Errorf("the %s issues are %v, want %s", state, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/search"
+	"github.com/tommyshem/ogi/cmd/storage"
+)
+
+// view save flags
+var viewRepos []string
+var viewAllRepos bool
+
+// view run flags
+var viewSort string
+var viewAsc bool
+var viewDesc bool
+var viewLimit int
+var viewOffset int
+
+// viewCmd groups the commands working on saved views.
+var viewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Save searches as named views and run them.",
+	Long: `A view is a search saved under a name in the central config, so the filters
+used every day don't need typing again:
+
+	ogi view save my-bugs 'is:open label:bug assignee:octocat sort:updated'
+	ogi view save triage --all-repos 'label:needs-triage created:<@today-7d'
+	ogi view run triage
+
+The query takes everything "ogi search" does. A view searches the current repo
+unless it was saved with --repos or --all-repos.`,
+}
+
+// viewSaveCmd saves a view, replacing the one of the same name.
+var viewSaveCmd = &cobra.Command{
+	Use:   "save <name> <query>",
+	Short: "Save a search as a view.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("You need to give a name and a search query!")
+			os.Exit(-1)
+		}
+		v := &View{Name: args[0], Query: strings.Join(args[1:], " "), AllRepos: viewAllRepos}
+		if _, err := search.Parse(v.Query); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		if viewAllRepos && len(viewRepos) > 0 {
+			fmt.Println("--repos and --all-repos can't be used together")
+			os.Exit(-1)
+		}
+		for _, r := range viewRepos {
+			if _, _, ok := splitRepo(r); !ok {
+				fmt.Printf("--repos %q is not in the owner/repo format\n", r)
+				os.Exit(-1)
+			}
+			v.Repos = append(v.Repos, r)
+		}
+		global := LoadGlobalConfig()
+		verb := "Saved"
+		if global.FindView(v.Name) != nil {
+			verb = "Updated"
+		}
+		global.PutView(v)
+		if err := global.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		fmt.Printf("%s view %q.\n", verb, v.Name)
+	},
+}
+
+// viewListCmd lists the saved views.
+var viewListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved views.",
+	Run: func(cmd *cobra.Command, args []string) {
+		views := LoadGlobalConfig().Views
+		if len(views) == 0 {
+			fmt.Println(`No views saved yet, see "ogi view save".`)
+			return
+		}
+		for _, v := range views {
+			where := ""
+			if v.AllRepos {
+				where = "\t(all repos)"
+			} else if len(v.Repos) > 0 {
+				where = fmt.Sprintf("\t(%s)", strings.Join(v.Repos, ", "))
+			}
+			fmt.Printf("%s\t%s%s\n", v.Name, v.Query, where)
+		}
+	},
+}
+
+// viewRunCmd runs a saved view.
+var viewRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Run a saved view.",
+	Long: `Run the search of a saved view. --sort, --asc and --desc order the issues
+instead of the view's own order, --offset and --limit show a page of them.
+Issues from several repos are shown with their repo.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("You need to give the name of a view!")
+			os.Exit(-1)
+		}
+		global := LoadGlobalConfig()
+		v := global.FindView(args[0])
+		if v == nil {
+			fmt.Printf("There is no view named %q, see \"ogi view list\".\n", args[0])
+			os.Exit(-1)
+		}
+		q, err := search.Parse(v.Query)
+		if err == nil {
+			err = viewOrder(cmd, q)
+		}
+		if err == nil && (viewLimit < 0 || viewOffset < 0) {
+			err = fmt.Errorf("--limit and --offset want a number of issues, not %d and %d", viewLimit, viewOffset)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		repos := v.Repos
+		if v.AllRepos {
+			repos = []string{}
+			for _, c := range global.Repos {
+				repos = append(repos, c.Name())
+			}
+		}
+		results, err := runView(q, repos)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		printResults(page(results, viewOffset, viewLimit), len(repos) > 1)
+	},
+}
+
+// viewDeleteCmd deletes a saved view.
+var viewDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a saved view.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("You need to give the name of a view!")
+			os.Exit(-1)
+		}
+		global := LoadGlobalConfig()
+		if !global.DeleteView(args[0]) {
+			fmt.Printf("There is no view named %q.\n", args[0])
+			os.Exit(-1)
+		}
+		if err := global.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Deleted view %q.\n", args[0])
+	},
+}
+
+// viewOrder applies the order flags of view run to the query.
+func viewOrder(cmd *cobra.Command, q *search.Query) error {
+	if viewAsc && viewDesc {
+		return fmt.Errorf("--asc and --desc can't be used together")
+	}
+	field, desc := q.Order()
+	changed := false
+	if cmd.Flags().Changed("sort") {
+		field, desc, changed = viewSort, viewSort != "number", true
+	}
+	if viewAsc || viewDesc {
+		desc, changed = viewDesc, true
+	}
+	if !changed {
+		return nil
+	}
+	if field == "" {
+		field = "number"
+	}
+	return q.OrderBy(field, desc)
+}
+
+// runView runs the query on the stored issues of the repos, or of the current
+// repo when none is given. Repos that weren't fetched are skipped.
+func runView(q *search.Query, repos []string) ([]search.Result, error) {
+	if len(repos) == 0 {
+		openStore()
+		return q.Run(db)
+	}
+	root, err := storage.Open(backendName())
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return searchRepos(root, q, repos)
+}
+
+// searchRepos runs the query on the stored issues of the repos of the database
+// opened by root and merges the results. Repos that weren't fetched are
+// skipped.
+func searchRepos(root storage.Storage, q *search.Query, repos []string) ([]search.Result, error) {
+	stored, err := root.Repos()
+	if err != nil {
+		return nil, err
+	}
+	results := [][]search.Result{}
+	for _, name := range repos {
+		owner, repo, _ := splitRepo(name)
+		// the repo is opened by its stored name, which may differ in case
+		i := slices.IndexFunc(stored, func(r storage.Repo) bool {
+			return strings.EqualFold(r.Owner, owner) && strings.EqualFold(r.Repo, repo)
+		})
+		if i < 0 {
+			fmt.Fprintf(os.Stderr, "%s has no offline issues, skipped. Fetch it with \"ogi fetch %s\".\n", name, name)
+			continue
+		}
+		s, err := root.ForRepo(stored[i].Owner, stored[i].Repo)
+		if err != nil {
+			return nil, err
+		}
+		r, err := q.Run(s)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return q.Merge(results...), nil
+}
+
+// init registers the view command and its sub commands with the root command.
+func init() {
+	RootCmd.AddCommand(viewCmd)
+	viewCmd.AddCommand(viewSaveCmd)
+	viewCmd.AddCommand(viewListCmd)
+	viewCmd.AddCommand(viewRunCmd)
+	viewCmd.AddCommand(viewDeleteCmd)
+	viewSaveCmd.Flags().StringSliceVar(&viewRepos, "repos", nil, "Search these repos <owner/repo> instead of the current one, repeat or separate them with commas")
+	viewSaveCmd.Flags().BoolVar(&viewAllRepos, "all-repos", false, "Search every tracked repo instead of the current one")
+	viewRunCmd.Flags().BoolVarP(&raw, "raw", "r", false, "Show the raw JSON for these issues")
+	viewRunCmd.Flags().StringVar(&viewSort, "sort", "number", "Order the issues by <number, created, updated, comments, reactions>")
+	viewRunCmd.Flags().BoolVar(&viewAsc, "asc", false, "Show the lowest values first")
+	viewRunCmd.Flags().BoolVar(&viewDesc, "desc", false, "Show the highest values first")
+	viewRunCmd.Flags().IntVar(&viewLimit, "limit", 0, "Show at most this many issues, all when 0")
+	viewRunCmd.Flags().IntVar(&viewOffset, "offset", 0, "Skip this many issues before showing them")
+}
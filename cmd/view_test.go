@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tommyshem/ogi/cmd/issue"
+	"github.com/tommyshem/ogi/cmd/search"
+	"github.com/tommyshem/ogi/cmd/storage/bolt"
+)
+
+func TestViews(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	names := func(g *GlobalConfig) string {
+		views := []string{}
+		for _, v := range g.Views {
+			views = append(views, v.Name+"="+v.Query)
+		}
+		return strings.Join(views, " ")
+	}
+
+	global := LoadGlobalConfig()
+	global.PutView(&View{Name: "my-bugs", Query: "label:bug"})
+	global.PutView(&View{Name: "triage", Query: "no:label", AllRepos: true})
+	global.PutView(&View{Name: "docs", Query: "label:docs", Repos: []string{"octo/hello", "octo/docs"}})
+	if err := global.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ogi", "config.yml")); err != nil {
+		t.Fatalf("the views weren't saved to XDG_CONFIG_HOME: %s", err)
+	}
+
+	global = LoadGlobalConfig()
+	if got := names(global); got != "my-bugs=label:bug triage=no:label docs=label:docs" {
+		t.Errorf("the saved views are %s", got)
+	}
+	if v := global.FindView("Triage"); v == nil || v.Query != "no:label" || !v.AllRepos {
+		t.Errorf("FindView(Triage) = %+v, want the triage view for all repos", v)
+	}
+	if v := global.FindView("docs"); v == nil || strings.Join(v.Repos, ",") != "octo/hello,octo/docs" {
+		t.Errorf("FindView(docs) = %+v, want the docs view of its two repos", v)
+	}
+	if v := global.FindView("nothing"); v != nil {
+		t.Errorf("FindView(nothing) = %+v, want nil", v)
+	}
+
+	// a view saved under a name in another case replaces it in place
+	global.PutView(&View{Name: "My-Bugs", Query: "label:bug is:open"})
+	if !global.DeleteView("TRIAGE") {
+		t.Errorf("DeleteView(TRIAGE) = false, want the triage view deleted")
+	}
+	if global.DeleteView("triage") {
+		t.Errorf("DeleteView(triage) = true after deleting it")
+	}
+	if err := global.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(LoadGlobalConfig()); got != "My-Bugs=label:bug is:open docs=label:docs" {
+		t.Errorf("after replacing my-bugs and deleting triage the views are %s", got)
+	}
+}
+
+func TestViewOrder(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []string
+		sort  string
+		desc  bool
+		err   bool
+	}{
+		{"is:open", nil, "", false, false},
+		{"sort:created", nil, "created", true, false},
+		{"sort:created", []string{"--asc"}, "created", false, false},
+		{"is:open", []string{"--desc"}, "number", true, false},
+		{"sort:created-asc", []string{"--sort", "updated"}, "updated", true, false},
+		{"sort:created", []string{"--sort", "number"}, "number", false, false},
+		{"is:open", []string{"--sort", "comments", "--asc"}, "comments", false, false},
+		{"is:open", []string{"--asc", "--desc"}, "", false, true},
+		{"is:open", []string{"--sort", "title"}, "", false, true},
+	}
+	for _, tt := range tests {
+		// a command of its own, so that no flag is left changed by another case
+		cmd := &cobra.Command{}
+		cmd.Flags().StringVar(&viewSort, "sort", "number", "")
+		cmd.Flags().BoolVar(&viewAsc, "asc", false, "")
+		cmd.Flags().BoolVar(&viewDesc, "desc", false, "")
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		q := mustParse(t, tt.query)
+		err := viewOrder(cmd, q)
+		if tt.err {
+			if err == nil {
+				t.Errorf("viewOrder of %q with %v succeeded, want an error", tt.query, tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("viewOrder of %q with %v: %s", tt.query, tt.args, err)
+			continue
+		}
+		if sort, desc := q.Order(); sort != tt.sort || desc != tt.desc {
+			t.Errorf("viewOrder of %q with %v sorts by %q desc %t, want %q desc %t", tt.query, tt.args, sort, desc, tt.sort, tt.desc)
+		}
+	}
+	viewSort, viewAsc, viewDesc = "number", false, false
+}
+
+// TestSearchRepos checks the results of a view over several repos are merged
+// in the view's order, and the repos never fetched are skipped.
+func TestSearchRepos(t *testing.T) {
+	root, err := bolt.OpenAt(filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	day := func(n int) time.Time { return time.Date(2020, 1, n, 12, 0, 0, 0, time.UTC) }
+	stored := map[string][]issue.Issue{
+		"octo/hello": {
+			{Number: 1, State: "open", Title: "Crash on start", CreatedAt: day(2), UpdatedAt: day(9)},
+			{Number: 3, State: "open", Title: "Docs", Body: "crash in the docs", CreatedAt: day(6), UpdatedAt: day(7)},
+			{Number: 4, State: "closed", Title: "Crash when closing", CreatedAt: day(1), UpdatedAt: day(1)},
+		},
+		"my-org/hello-world": {
+			{Number: 2, State: "open", Title: "Crash crash crash", CreatedAt: day(4), UpdatedAt: day(5)},
+			{Number: 5, State: "open", Title: "Slow", CreatedAt: day(3), UpdatedAt: day(8)},
+		},
+	}
+	for name, issues := range stored {
+		owner, repo, _ := splitRepo(name)
+		s, err := root.ForRepo(owner, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range issues {
+			if err := s.Save(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	repos := []string{"octo/hello", "octo/never", "My-Org/Hello-World"}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// without an order the repos follow each other
+		{"is:open", "octo/hello#1 octo/hello#3 my-org/hello-world#2 my-org/hello-world#5"},
+		{"is:open sort:created", "octo/hello#3 my-org/hello-world#2 my-org/hello-world#5 octo/hello#1"},
+		{"is:open sort:created-asc", "octo/hello#1 my-org/hello-world#5 my-org/hello-world#2 octo/hello#3"},
+		{"sort:updated", "octo/hello#1 my-org/hello-world#5 octo/hello#3 my-org/hello-world#2 octo/hello#4"},
+		// text is ordered by relevance across the repos
+		{"is:open crash", "my-org/hello-world#2 octo/hello#1 octo/hello#3"},
+		{"is:closed", "octo/hello#4"},
+	}
+	for _, tt := range tests {
+		q := mustParse(t, tt.query)
+		var results []search.Result
+		var err error
+		skipped := captureStderr(t, func() {
+			results, err = searchRepos(root, q, repos)
+		})
+		if err != nil {
+			t.Errorf("searchRepos of %q: %s", tt.query, err)
+			continue
+		}
+		got := []string{}
+		for _, r := range results {
+			got = append(got, fmt.Sprintf("%s/%s#%d", r.Repo.Owner, r.Repo.Repo, r.Issue.Number))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("searchRepos of %q = %s, want %s", tt.query, strings.Join(got, " "), tt.want)
+		}
+		if !strings.Contains(skipped, `octo/never has no offline issues, skipped. Fetch it with "ogi fetch octo/never".`) || strings.Contains(skipped, "hello") {
+			t.Errorf("searchRepos of %q printed %q, want only octo/never skipped", tt.query, skipped)
+		}
+	}
+
+	// skipping a repo doesn't add it to the database
+	fetched, err := root.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("the database holds %+v after the views, want the two fetched repos", fetched)
+	}
+
+	results, err := searchRepos(root, mustParse(t, "is:open"), nil)
+	if err != nil || len(results) != 0 {
+		t.Errorf("searchRepos of no repos = %d results, %v, want none", len(results), err)
+	}
+}
+
+// mustParse parses a search query, failing the test on an error.
+func mustParse(t *testing.T, query string) *search.Query {
+	t.Helper()
+	q, err := search.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// captureStderr returns what f writes to the standard error.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
@@ -4,16 +4,20 @@ go 1.23.1
 
 require (
 	github.com/google/go-github v17.0.0+incompatible
+	golang.org/x/term v0.25.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 // https://github.com/nutsdb/nutsdb
+// nutsdb is pinned to v1.0.4: skipUsedBucketIDs in cmd/storage/nutsdb works
+// around its reuse of bucket IDs after a reopen by reading its bucket file.
+// Check that workaround, and TestReopenKeepsBuckets, before upgrading.
 require (
 	github.com/antlabs/stl v0.0.2 // indirect
 	github.com/antlabs/timer v0.1.4 // indirect
 	github.com/bwmarrin/snowflake v0.3.0 // indirect
 	github.com/gofrs/flock v0.12.1 // indirect
-	github.com/nutsdb/nutsdb v1.0.4 // indirect
+	github.com/nutsdb/nutsdb v1.0.4
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/tidwall/btree v1.7.0 // indirect
 	github.com/xujiajun/mmap-go v1.0.1 // indirect
@@ -21,7 +25,6 @@ require (
 )
 
 require (
-	github.com/boltdb/bolt v1.3.1
 	github.com/briandowns/spinner v1.23.1
 	github.com/fatih/color v1.18.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
@@ -31,7 +34,7 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.8.1
 	github.com/spf13/pflag v1.0.5 // indirect
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/oauth2 v0.23.0
 	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/term v0.25.0 // indirect
 )